@@ -0,0 +1,359 @@
+package vibekanbanplugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(adminAPI{})
+}
+
+// defaultInstanceName is the name of handlers configured without one.
+const defaultInstanceName = "default"
+
+// adminPath is where the admin API is mounted on Caddy's admin endpoint.
+const adminPath = "/vk/rewrite/"
+
+// overridePrefix is the storage key prefix runtime overrides persist under.
+const overridePrefix = "vk_rewrite/overrides"
+
+// RuleOverride replaces a handler's cloud URL and/or rules at runtime,
+// without a config reload. A null field keeps the configured value; an
+// empty cloud URL turns cloud rewriting off.
+type RuleOverride struct {
+	CloudURL *string       `json:"cloud_url"`
+	Rules    []RewriteRule `json:"rules"`
+}
+
+// liveHandlers tracks provisioned handlers by name, and the overrides
+// applied through the admin API, across config reloads.
+type liveHandlers struct {
+	mu        sync.Mutex
+	byName    map[string][]*PluginInjector
+	overrides map[string]*RuleOverride
+
+	// storage persists overrides; it is set once the admin API is provisioned
+	storage certmagic.Storage
+}
+
+// handlers is the process-wide handler registry the admin API serves.
+var handlers = &liveHandlers{
+	byName:    make(map[string][]*PluginInjector),
+	overrides: make(map[string]*RuleOverride),
+}
+
+// instanceName is the name the handler is registered under.
+func (p *PluginInjector) instanceName() string {
+	if p.Name == "" {
+		return defaultInstanceName
+	}
+	return p.Name
+}
+
+// ruleSetFor builds the rule set the handler runs with under an override,
+// or its configured rule set when o is nil.
+func (p *PluginInjector) ruleSetFor(o *RuleOverride) (*ruleSet, error) {
+	cloudURL, standbyURLs, rules := p.resolvedCloudURL, p.standbyURLs, p.Rules
+	if o != nil {
+		if o.CloudURL != nil {
+			cloudURL, standbyURLs = normalizeCloudURL(*o.CloudURL), nil
+			if cloudURL != "" {
+				if err := checkCloudURL(cloudURL); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if o.Rules != nil {
+			rules = o.Rules
+		}
+	}
+	set, err := buildRuleSet(p.ctx, cloudURL, rules)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.attachAlternates(p.ctx, set, standbyURLs, rules); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// add registers a provisioned handler and applies any override for its name.
+// An override that doesn't fit the new config is logged and ignored.
+func (h *liveHandlers) add(p *PluginInjector) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name := p.instanceName()
+	h.byName[name] = append(h.byName[name], p)
+	if o := h.overrides[name]; o != nil {
+		set, err := p.ruleSetFor(o)
+		if err != nil {
+			p.logger.Warn("ignoring runtime rule override", zap.String("name", name), zap.Error(err))
+			return
+		}
+		p.rules.current.Store(set)
+		p.logger.Info("applied runtime rule override",
+			zap.String("name", name),
+			zap.String("cloud_url", set.cloudURL))
+	}
+}
+
+// remove unregisters a handler that is being cleaned up.
+func (h *liveHandlers) remove(p *PluginInjector) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name := p.instanceName()
+	list := h.byName[name]
+	for i, q := range list {
+		if q == p {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(h.byName, name)
+	} else {
+		h.byName[name] = list
+	}
+}
+
+// set applies an override to every handler with the name, or restores
+// their configured rules when o is nil, and persists the change. Nothing
+// is applied unless the override is valid for all of them, and an override
+// for a name no handler has is rejected rather than stored.
+func (h *liveHandlers) set(ctx context.Context, name string, o *RuleOverride) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := h.byName[name]
+	if o != nil && len(list) == 0 {
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("no handler named %q", name)}
+	}
+	sets := make([]*ruleSet, len(list))
+	for i, p := range list {
+		set, err := p.ruleSetFor(o)
+		if err != nil {
+			return err
+		}
+		sets[i] = set
+	}
+
+	if h.storage != nil {
+		key := path.Join(overridePrefix, name+".json")
+		if o == nil {
+			if err := h.storage.Delete(ctx, key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("deleting override: %v", err)
+			}
+		} else {
+			data, err := json.Marshal(o)
+			if err != nil {
+				return err
+			}
+			if err := h.storage.Store(ctx, key, data); err != nil {
+				return fmt.Errorf("storing override: %v", err)
+			}
+		}
+	}
+
+	if o == nil {
+		delete(h.overrides, name)
+	} else {
+		h.overrides[name] = o
+	}
+	for i, p := range list {
+		p.rules.current.Store(sets[i])
+	}
+	return nil
+}
+
+// load reads persisted overrides from storage and applies them to the
+// registered handlers. Later changes are persisted to the same storage.
+func (h *liveHandlers) load(ctx context.Context, storage certmagic.Storage, logger *zap.Logger) {
+	h.mu.Lock()
+	h.storage = storage
+	h.mu.Unlock()
+
+	keys, err := storage.List(ctx, overridePrefix, false)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Error("listing persisted rule overrides", zap.Error(err))
+		}
+		return
+	}
+	for _, key := range keys {
+		name, ok := strings.CutSuffix(path.Base(key), ".json")
+		if !ok {
+			continue
+		}
+		data, err := storage.Load(ctx, key)
+		if err != nil {
+			logger.Error("loading persisted rule override", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		var o RuleOverride
+		if err := json.Unmarshal(data, &o); err != nil {
+			logger.Error("decoding persisted rule override", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if err := h.set(ctx, name, &o); err != nil {
+			logger.Error("applying persisted rule override", zap.String("name", name), zap.Error(err))
+		}
+	}
+}
+
+// handlerStatus is how the admin API reports one provisioned handler.
+type handlerStatus struct {
+	Name     string          `json:"name"`
+	CloudURL string          `json:"cloud_url"`
+	Rules    []ruleStatus    `json:"rules"`
+	Override *RuleOverride   `json:"override,omitempty"`
+	Health   []healthStatus  `json:"health,omitempty"`
+	Config   *PluginInjector `json:"config"`
+}
+
+// ruleStatus is an effective rule and the replacements it has made.
+type ruleStatus struct {
+	RewriteRule
+	Hits int64 `json:"hits"`
+}
+
+// status reports the handlers registered under name, or all of them if
+// name is empty, ordered by name.
+func (h *liveHandlers) status(name string) []handlerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := []string{name}
+	if name == "" {
+		names = names[:0]
+		for n := range h.byName {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+	}
+
+	out := []handlerStatus{}
+	for _, n := range names {
+		for _, p := range h.byName[n] {
+			set := p.currentRules()
+			st := handlerStatus{
+				Name:     n,
+				CloudURL: set.cloudURL,
+				Rules:    make([]ruleStatus, len(set.rules)),
+				Override: h.overrides[n],
+				Health:   p.cloudHealth(),
+				Config:   p,
+			}
+			for i, rule := range set.rules {
+				st.Rules[i] = ruleStatus{RewriteRule: rule}
+				if rule.hits != nil {
+					st.Rules[i].Hits = rule.hits.Load()
+				}
+			}
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// adminAPI serves the rewrite handlers on Caddy's admin endpoint:
+//
+//	GET    /vk/rewrite/        every handler's config, effective rules and hit counts
+//	GET    /vk/rewrite/<name>  the handlers with that name
+//	PUT    /vk/rewrite/<name>  apply and persist a RuleOverride
+//	DELETE /vk/rewrite/<name>  drop the override, restoring the configured rules
+type adminAPI struct {
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (adminAPI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.vk_rewrite",
+		New: func() caddy.Module { return new(adminAPI) },
+	}
+}
+
+// Provision loads persisted overrides once the handlers are provisioned.
+func (a *adminAPI) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+	handlers.load(ctx, ctx.Storage(), a.logger)
+	return nil
+}
+
+// Routes implements caddy.AdminRouter.
+func (a *adminAPI) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{{
+		Pattern: adminPath,
+		Handler: caddy.AdminHandlerFunc(a.handle),
+	}}
+}
+
+// handle serves the admin API.
+func (a *adminAPI) handle(w http.ResponseWriter, r *http.Request) error {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, adminPath), "/")
+	if name != "" && !pluginNamePattern.MatchString(name) {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("invalid handler name %q", name)}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status := handlers.status(name)
+		if name != "" && len(status) == 0 {
+			return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("no handler named %q", name)}
+		}
+		return writeJSON(w, status)
+
+	case http.MethodPut, http.MethodDelete:
+		if name == "" {
+			return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("handler name required")}
+		}
+		var o *RuleOverride
+		if r.Method == http.MethodPut {
+			o = new(RuleOverride)
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(o); err != nil {
+				return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("decoding override: %v", err)}
+			}
+		}
+		if err := handlers.set(r.Context(), name, o); err != nil {
+			var apiErr caddy.APIError
+			if errors.As(err, &apiErr) {
+				return err
+			}
+			return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: err}
+		}
+		if a.logger != nil {
+			a.logger.Info("updated rewrite rules at runtime",
+				zap.String("name", name),
+				zap.Bool("override", o != nil))
+		}
+		return writeJSON(w, handlers.status(name))
+
+	default:
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method %s not allowed", r.Method)}
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Interface guards
+var (
+	_ caddy.AdminRouter = (*adminAPI)(nil)
+	_ caddy.Provisioner = (*adminAPI)(nil)
+)
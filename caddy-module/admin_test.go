@@ -0,0 +1,229 @@
+package vibekanbanplugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/certmagic"
+)
+
+// withAdminStorage points the handler registry at a temporary storage and
+// forgets the test's overrides afterwards
+func withAdminStorage(t *testing.T) certmagic.Storage {
+	t.Helper()
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	handlers.mu.Lock()
+	handlers.storage = storage
+	handlers.mu.Unlock()
+	t.Cleanup(func() {
+		handlers.mu.Lock()
+		defer handlers.mu.Unlock()
+		handlers.storage = nil
+		handlers.overrides = make(map[string]*RuleOverride)
+	})
+	return storage
+}
+
+// provisionNamed provisions a handler registered under name
+func provisionNamed(t *testing.T, name string) *PluginInjector {
+	t.Helper()
+	injector := &PluginInjector{Name: name, CloudURL: "https://vk.example.com"}
+	if err := injector.Provision(createTestContext(t)); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	t.Cleanup(func() { injector.Cleanup() })
+	return injector
+}
+
+// adminRequest sends a request to the admin API and decodes the response
+func adminRequest(t *testing.T, method, path, body string) ([]handlerStatus, int) {
+	t.Helper()
+	var api adminAPI
+	rec := httptest.NewRecorder()
+	err := api.handle(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var apiErr caddy.APIError
+	if errors.As(err, &apiErr) {
+		return nil, apiErr.HTTPStatus
+	}
+	if err != nil {
+		t.Fatalf("Admin API returned error: %v", err)
+	}
+	var status []handlerStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode admin response %q: %v", rec.Body.String(), err)
+	}
+	return status, http.StatusOK
+}
+
+// rewriteWith serves a JS response through the injector and returns the body
+func rewriteWith(t *testing.T, injector *PluginInjector, js string) string {
+	t.Helper()
+	upstream := mockNextHandler([]byte(js), 200, map[string][]string{"Content-Type": {"application/javascript"}})
+	rec := httptest.NewRecorder()
+	if err := injector.ServeHTTP(rec, httptest.NewRequest("GET", "/assets/index.js", nil), upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	return rec.Body.String()
+}
+
+// Verify the admin API reports, overrides and restores a handler's rules
+func TestAdminAPI(t *testing.T) {
+	// ARRANGE
+	storage := withAdminStorage(t)
+	injector := provisionNamed(t, "admin-api")
+	js := `fetch("https://api.vibekanban.com/v1")`
+	rewriteWith(t, injector, js)
+
+	// ACT
+	status, code := adminRequest(t, "GET", "/vk/rewrite/admin-api", "")
+
+	// ASSERT
+	if code != http.StatusOK || len(status) != 1 {
+		t.Fatalf("Expected one handler, got %d %+v", code, status)
+	}
+	if status[0].CloudURL != "https://vk.example.com" || len(status[0].Rules) != 1 || status[0].Rules[0].Hits != 1 {
+		t.Errorf("Expected configured cloud rule with one hit, got %+v", status[0])
+	}
+	if status[0].Config == nil || status[0].Config.CloudURL != "https://vk.example.com" {
+		t.Errorf("Expected configured handler JSON, got %+v", status[0].Config)
+	}
+
+	// ACT
+	status, code = adminRequest(t, "PUT", "/vk/rewrite/admin-api",
+		`{"cloud_url": "https://staging.example.com", "rules": [{"from": "/v1", "to": "/v2"}]}`)
+
+	// ASSERT
+	if code != http.StatusOK || status[0].CloudURL != "https://staging.example.com" || len(status[0].Rules) != 2 {
+		t.Fatalf("Expected override to apply, got %d %+v", code, status)
+	}
+	if got := rewriteWith(t, injector, js); got != `fetch("https://staging.example.com/v2")` {
+		t.Errorf("Expected overridden rules in response, got %q", got)
+	}
+	if exists := storage.Exists(context.Background(), "vk_rewrite/overrides/admin-api.json"); !exists {
+		t.Error("Expected override to be persisted")
+	}
+
+	// ACT
+	status, code = adminRequest(t, "DELETE", "/vk/rewrite/admin-api", "")
+
+	// ASSERT
+	if code != http.StatusOK || status[0].CloudURL != "https://vk.example.com" || status[0].Override != nil {
+		t.Fatalf("Expected configured rules restored, got %d %+v", code, status)
+	}
+	if got := rewriteWith(t, injector, js); got != `fetch("https://vk.example.com/v1")` {
+		t.Errorf("Expected configured rules in response, got %q", got)
+	}
+	if exists := storage.Exists(context.Background(), "vk_rewrite/overrides/admin-api.json"); exists {
+		t.Error("Expected persisted override to be deleted")
+	}
+}
+
+// Verify the admin API rejects bad requests without changing anything
+func TestAdminAPIErrors(t *testing.T) {
+	withAdminStorage(t)
+	injector := provisionNamed(t, "admin-errors")
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"unknown handler", "GET", "/vk/rewrite/nope", "", http.StatusNotFound},
+		{"invalid name", "GET", "/vk/rewrite/..", "", http.StatusBadRequest},
+		{"invalid regexp", "PUT", "/vk/rewrite/admin-errors", `{"rules": [{"from": "(", "regexp": true}]}`, http.StatusBadRequest},
+		{"unknown field", "PUT", "/vk/rewrite/admin-errors", `{"cloud": "https://x.example.com"}`, http.StatusBadRequest},
+		{"missing name", "PUT", "/vk/rewrite/", `{}`, http.StatusBadRequest},
+		{"method", "POST", "/vk/rewrite/admin-errors", `{}`, http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ACT
+			_, code := adminRequest(t, tc.method, tc.path, tc.body)
+
+			// ASSERT
+			if code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, code)
+			}
+			if got := injector.currentRules().cloudURL; got != "https://vk.example.com" {
+				t.Errorf("Expected configured cloud URL to stay, got %q", got)
+			}
+		})
+	}
+}
+
+// Verify an override for a name no handler has is rejected, not stored
+func TestAdminAPIUnknownName(t *testing.T) {
+	// ARRANGE
+	storage := withAdminStorage(t)
+	provisionNamed(t, "admin-known")
+
+	// ACT
+	_, code := adminRequest(t, "PUT", "/vk/rewrite/admin-knwon", `{"cloud_url": "https://staging.example.com"}`)
+
+	// ASSERT
+	if code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", code)
+	}
+	if storage.Exists(context.Background(), "vk_rewrite/overrides/admin-knwon.json") {
+		t.Error("Expected no override to be persisted for an unknown name")
+	}
+	handlers.mu.Lock()
+	_, stored := handlers.overrides["admin-knwon"]
+	handlers.mu.Unlock()
+	if stored {
+		t.Error("Expected no override to be kept for an unknown name")
+	}
+
+	// ACT: removing an override stays lenient
+	_, code = adminRequest(t, "DELETE", "/vk/rewrite/admin-knwon", "")
+
+	// ASSERT
+	if code != http.StatusOK {
+		t.Errorf("Expected DELETE of an unknown name to succeed, got %d", code)
+	}
+}
+
+// Verify persisted overrides survive restarts and config reloads
+func TestAdminAPIPersistedOverride(t *testing.T) {
+	// ARRANGE
+	storage := withAdminStorage(t)
+	data := []byte(`{"cloud_url": "https://staging.example.com", "rules": null}`)
+	if err := storage.Store(context.Background(), "vk_rewrite/overrides/admin-persisted.json", data); err != nil {
+		t.Fatalf("Failed to store override: %v", err)
+	}
+	injector := provisionNamed(t, "admin-persisted")
+
+	// ACT
+	handlers.load(context.Background(), storage, injector.logger)
+	reloaded := provisionNamed(t, "admin-persisted")
+
+	// ASSERT
+	for _, p := range []*PluginInjector{injector, reloaded} {
+		if got := p.currentRules().cloudURL; got != "https://staging.example.com" {
+			t.Errorf("Expected persisted cloud URL, got %q", got)
+		}
+	}
+}
+
+// Verify Caddyfile parsing of the name subdirective
+func TestUnmarshalCaddyfileName(t *testing.T) {
+	d := caddyfile.NewTestDispenser("vk_rewrite {\nname staging\n}")
+
+	var p PluginInjector
+	if err := p.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.Name != "staging" {
+		t.Errorf("Expected name staging, got %q", p.Name)
+	}
+}
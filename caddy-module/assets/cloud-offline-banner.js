@@ -0,0 +1,29 @@
+/**
+ * Vibe Kanban cloud offline notice
+ *
+ * Injected by the vk_rewrite Caddy module into pages served while its health
+ * check can't reach the configured cloud instance.
+ */
+(function () {
+  'use strict';
+
+  function show() {
+    if (document.getElementById('vk-cloud-offline')) {
+      return;
+    }
+    var banner = document.createElement('div');
+    banner.id = 'vk-cloud-offline';
+    banner.setAttribute('role', 'status');
+    banner.textContent =
+      'The Vibe Kanban cloud is unreachable. Sign-in, sync and sharing may not work until it is back.';
+    banner.style.cssText =
+      'position:fixed;top:0;left:0;right:0;z-index:2147483647;padding:8px 12px;' +
+      'background:#b45309;color:#fff;font:14px/1.4 system-ui,sans-serif;text-align:center';
+    document.body.appendChild(banner);
+  }
+  if (document.body) {
+    show();
+  } else {
+    document.addEventListener('DOMContentLoaded', show);
+  }
+})();
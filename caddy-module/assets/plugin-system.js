@@ -0,0 +1,82 @@
+/**
+ * Vibe Kanban Plugin System
+ *
+ * Injected into the Vibe Kanban UI by the vk_rewrite Caddy module. Provides a
+ * small registry plugins use to hook into the page without forking VK, and
+ * loads the plugins listed in the manifest named by data-vk-plugins.
+ */
+(function () {
+  'use strict';
+
+  var current = document.currentScript;
+  var manifestURL = current && current.getAttribute('data-vk-plugins');
+
+  if (window.VibeKanbanPlugins) {
+    return;
+  }
+
+  var plugins = {};
+
+  function whenReady(fn) {
+    if (document.readyState === 'loading') {
+      document.addEventListener('DOMContentLoaded', fn, { once: true });
+    } else {
+      fn();
+    }
+  }
+
+  window.VibeKanbanPlugins = {
+    // config is window.__VK_CONFIG__ when the module injects it
+    config: window.__VK_CONFIG__ || {},
+
+    // register runs setup once the DOM is ready; names must be unique
+    register: function (name, setup) {
+      if (plugins[name]) {
+        console.warn('[vk-plugins] plugin already registered:', name);
+        return;
+      }
+      plugins[name] = { name: name };
+      whenReady(function () {
+        try {
+          setup(window.VibeKanbanPlugins);
+        } catch (err) {
+          console.error('[vk-plugins] plugin failed:', name, err);
+        }
+      });
+    },
+
+    list: function () {
+      return Object.keys(plugins);
+    },
+  };
+
+  // loadPlugins appends each manifest entry as a script, preserving order
+  function loadPlugins(url) {
+    fetch(url, { credentials: 'same-origin' })
+      .then(function (res) {
+        if (!res.ok) {
+          throw new Error('HTTP ' + res.status);
+        }
+        return res.json();
+      })
+      .then(function (manifest) {
+        (manifest.plugins || []).forEach(function (plugin) {
+          var script = document.createElement('script');
+          script.src = plugin.url;
+          script.async = false;
+          script.setAttribute('data-vk-plugin', plugin.name);
+          script.onerror = function () {
+            console.error('[vk-plugins] failed to load plugin:', plugin.name);
+          };
+          document.head.appendChild(script);
+        });
+      })
+      .catch(function (err) {
+        console.error('[vk-plugins] failed to load manifest:', err);
+      });
+  }
+
+  if (manifestURL) {
+    loadPlugins(manifestURL);
+  }
+})();
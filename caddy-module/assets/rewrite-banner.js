@@ -0,0 +1,30 @@
+/**
+ * Vibe Kanban rewrite warning
+ *
+ * Appended by the vk_rewrite Caddy module to a response its expect_rewrites
+ * canary flagged: the rules didn't change a bundle they were expected to, so
+ * the app may be talking to the public cloud.
+ */
+(function () {
+  'use strict';
+
+  function show() {
+    if (document.getElementById('vk-rewrite-warning')) {
+      return;
+    }
+    var banner = document.createElement('div');
+    banner.id = 'vk-rewrite-warning';
+    banner.setAttribute('role', 'alert');
+    banner.textContent =
+      'Vibe Kanban cloud URL rewriting failed: this app may be talking to the public cloud instead of your instance.';
+    banner.style.cssText =
+      'position:fixed;top:0;left:0;right:0;z-index:2147483647;padding:8px 12px;' +
+      'background:#b91c1c;color:#fff;font:14px/1.4 system-ui,sans-serif;text-align:center';
+    document.body.appendChild(banner);
+  }
+  if (document.body) {
+    show();
+  } else {
+    document.addEventListener('DOMContentLoaded', show);
+  }
+})();
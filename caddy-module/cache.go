@@ -0,0 +1,159 @@
+package vibekanbanplugins
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultCacheSize is the rewrite cache capacity in bytes when none is configured.
+const defaultCacheSize = 64 << 20
+
+// rendered is a final response body, the content coding it is in, and the
+// replacements made producing it.
+type rendered struct {
+	body     []byte
+	encoding string
+	stats    rewriteStats
+}
+
+// rewriteCache is a size-bounded LRU of transformed response bodies.
+// Cached bodies are shared between requests and must not be modified.
+type rewriteCache struct {
+	mu      sync.Mutex
+	maxSize int
+	size    int
+	ll      *list.List
+	items   map[string]*list.Element
+
+	// flight coalesces concurrent misses for the same key
+	flight singleflight.Group
+}
+
+// cacheEntry is one cached body.
+type cacheEntry struct {
+	key string
+	rendered
+}
+
+// newRewriteCache creates a cache holding up to maxSize bytes of bodies.
+func newRewriteCache(maxSize int) *rewriteCache {
+	return &rewriteCache{
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached body for key, marking it recently used.
+func (c *rewriteCache) get(key string) (rendered, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return rendered{}, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*cacheEntry).rendered, true
+}
+
+// add stores a body, evicting the least recently used entries to stay within
+// maxSize. Bodies larger than the whole cache are not stored.
+func (c *rewriteCache) add(key string, out rendered) {
+	if len(out.body) > c.maxSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.size -= len(el.Value.(*cacheEntry).body)
+		el.Value.(*cacheEntry).rendered = out
+		c.size += len(out.body)
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&cacheEntry{key: key, rendered: out})
+		c.size += len(out.body)
+	}
+	for c.size > c.maxSize {
+		oldest := c.ll.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.ll.Remove(oldest)
+		delete(c.items, entry.key)
+		c.size -= len(entry.body)
+	}
+}
+
+// len reports the number of cached entries.
+func (c *rewriteCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// cacheKey identifies a transformed body by request path, upstream ETag,
+// transform tag, the response's encoding and type, and the variant it is
+// rendered as. Only GET responses are cached; HEAD responses have no body to
+// share, and responses without an ETag or marked no-store are not cached.
+func (p *PluginInjector) cacheKey(r *http.Request, cond *conditional, statusCode int, headers http.Header, variant string) (string, bool) {
+	if p.cache == nil || cond == nil || statusCode != http.StatusOK || r.Method != http.MethodGet {
+		return "", false
+	}
+	etag := headers.Get("ETag")
+	if etag == "" || strings.Contains(strings.ToLower(headers.Get("Cache-Control")), "no-store") {
+		return "", false
+	}
+	return strings.Join([]string{
+		r.URL.Path,
+		r.URL.RawQuery,
+		etag,
+		cond.transformTag(),
+		headers.Get("Content-Encoding"),
+		headers.Get("Content-Type"),
+		variant,
+	}, "\x00"), true
+}
+
+// render produces the final body for a buffered response: transformed in the
+// upstream coding, or as the negotiated variant when compressing. It reports
+// false if the variant could not be produced.
+func (p *PluginInjector) render(r *http.Request, headers http.Header, body []byte, variant string) (rendered, bool) {
+	var out rendered
+	ok := true
+	if variant == "" {
+		out = rendered{body: p.processResponse(r, headers, body), encoding: contentCoding(headers)}
+	} else {
+		out, ok = p.compressBody(r, headers, body, variant)
+	}
+	if stats := statsFor(r); stats != nil {
+		out.stats = *stats
+	}
+	return out, ok
+}
+
+// renderCached renders a buffered response once per cache key: concurrent
+// identical misses share one rewrite and the result is kept for later hits.
+func (p *PluginInjector) renderCached(r *http.Request, key string, headers http.Header, body []byte, variant string) (rendered, bool) {
+	type result struct {
+		out rendered
+		ok  bool
+	}
+	v, _, shared := p.cache.flight.Do(key, func() (any, error) {
+		if cached, ok := p.cache.get(key); ok {
+			return result{cached, true}, nil
+		}
+		out, ok := p.render(r, headers, body, variant)
+		if ok && p.shouldWriteResponseBody(r.Method, http.StatusOK) {
+			p.cache.add(key, out)
+		}
+		return result{out, ok}, nil
+	})
+	if shared && p.logger != nil {
+		p.logger.Debug("shared rewrite with concurrent request", zap.String("path", r.URL.Path))
+	}
+	res := v.(result)
+	return res.out, res.ok
+}
@@ -0,0 +1,253 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Verify the LRU evicts the least recently used entries to stay within size
+func TestRewriteCacheEviction(t *testing.T) {
+	// ARRANGE
+	c := newRewriteCache(10)
+
+	// ACT
+	c.add("a", rendered{body: []byte("aaaa")})
+	c.add("b", rendered{body: []byte("bbbb")})
+	c.get("a")
+	c.add("c", rendered{body: []byte("cccc")})
+	c.add("huge", rendered{body: []byte("this is more than ten bytes")})
+
+	// ASSERT
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("Expected recently used entry to be kept")
+	}
+	if _, ok := c.get("huge"); ok {
+		t.Error("Expected oversized entry not to be cached")
+	}
+	if c.len() != 2 || c.size != 8 {
+		t.Errorf("Expected 2 entries totalling 8 bytes, got %d entries, %d bytes", c.len(), c.size)
+	}
+}
+
+// Verify hits are served from the cache and keys follow the upstream ETag
+func TestCacheHitsByETag(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Cache: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	serve := func(body, etag string) string {
+		upstream := mockNextHandler([]byte(body), 200, http.Header{
+			"Content-Type": []string{"application/javascript"},
+			"ETag":         []string{etag},
+		})
+		req := httptest.NewRequest("GET", "/assets/index-abc123.js", nil)
+		rec := httptest.NewRecorder()
+		if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+		if got := rec.Header().Get("Content-Length"); got != "" && got != strconv.Itoa(rec.Body.Len()) {
+			t.Errorf("Content-Length %s does not match body length %d", got, rec.Body.Len())
+		}
+		return rec.Body.String()
+	}
+
+	// ACT
+	first := serve(`a("https://api.vibekanban.com")`, `"v1"`)
+	// Same validator: the cached body is served even though upstream differs
+	hit := serve(`b("https://api.vibekanban.com")`, `"v1"`)
+	// New validator: rewritten afresh
+	miss := serve(`c("https://api.vibekanban.com")`, `"v2"`)
+
+	// ASSERT
+	if first != `a("https://vk.example.com")` {
+		t.Errorf("Unexpected first body %q", first)
+	}
+	if hit != first {
+		t.Errorf("Expected cached body %q, got %q", first, hit)
+	}
+	if miss != `c("https://vk.example.com")` {
+		t.Errorf("Expected fresh rewrite for new ETag, got %q", miss)
+	}
+	if injector.cache.len() != 2 {
+		t.Errorf("Expected 2 cache entries, got %d", injector.cache.len())
+	}
+}
+
+// Verify responses without an ETag or marked no-store bypass the cache
+func TestCacheSkipsUncacheable(t *testing.T) {
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Cache: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		headers http.Header
+	}{
+		{"no etag", http.Header{"Content-Type": {"application/javascript"}}},
+		{"no-store", http.Header{
+			"Content-Type":  {"application/javascript"},
+			"ETag":          {`"v1"`},
+			"Cache-Control": {"private, no-store"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := mockNextHandler([]byte(`x("https://api.vibekanban.com")`), 200, tc.headers)
+			req := httptest.NewRequest("GET", "/assets/index.js", nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if rec.Body.String() != `x("https://vk.example.com")` {
+				t.Errorf("Unexpected body %q", rec.Body.String())
+			}
+			if injector.cache.len() != 0 {
+				t.Errorf("Expected nothing cached, got %d entries", injector.cache.len())
+			}
+		})
+	}
+}
+
+// Verify concurrent identical misses all get the rewritten body
+func TestCacheConcurrentMisses(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Cache: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	const requests = 10
+	chunk := strings.Repeat(`f("https://api.vibekanban.com");`, 10000)
+	expected := strings.Repeat(`f("https://vk.example.com");`, 10000)
+	// Hold every response until all requests have missed the cache
+	var arrived sync.WaitGroup
+	arrived.Add(requests)
+	upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("ETag", `"chunk"`)
+		w.WriteHeader(http.StatusOK)
+		arrived.Done()
+		arrived.Wait()
+		_, err := w.Write([]byte(chunk))
+		return err
+	})
+
+	// ACT
+	bodies := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/assets/chunk.js", nil)
+			rec := httptest.NewRecorder()
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Errorf("Handler returned error: %v", err)
+			}
+			bodies[i] = rec.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	// ASSERT
+	for i, body := range bodies {
+		if body != expected {
+			t.Errorf("Request %d: unexpected body of %d bytes", i, len(body))
+		}
+	}
+	if injector.cache.len() != 1 {
+		t.Errorf("Expected a single cache entry, got %d", injector.cache.len())
+	}
+	if got := testutil.ToFloat64(injector.metrics.replacements.WithLabelValues("cloud_url")); got != 10000 {
+		t.Errorf("Expected the body to be rewritten once (10000 replacements), got %v", got)
+	}
+}
+
+// Verify a HEAD request doesn't cache an empty body for later GETs
+func TestCacheHeadThenGet(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Cache: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	body := []byte(`x("https://api.vibekanban.com")`)
+	upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+		return nil
+	})
+	serve := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/assets/index.js", nil)
+		rec := httptest.NewRecorder()
+		if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+		return rec
+	}
+
+	// ACT
+	head := serve(http.MethodHead)
+	get := serve(http.MethodGet)
+
+	// ASSERT
+	if head.Body.Len() != 0 {
+		t.Errorf("Expected no body for HEAD, got %q", head.Body.String())
+	}
+	if get.Body.String() != `x("https://vk.example.com")` {
+		t.Errorf("Expected rewritten body for GET after HEAD, got %q", get.Body.String())
+	}
+	if got := get.Header().Get("Content-Length"); got != strconv.Itoa(get.Body.Len()) {
+		t.Errorf("Expected Content-Length %d, got %q", get.Body.Len(), got)
+	}
+	if injector.cache.len() != 1 {
+		t.Errorf("Expected only the GET to be cached, got %d entries", injector.cache.len())
+	}
+}
+
+// Verify Caddyfile parsing of the cache subdirective
+func TestUnmarshalCaddyfileCache(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		cache 16MiB
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if !p.Cache || p.CacheSize != 16<<20 {
+		t.Errorf("Expected 16MiB cache, got enabled=%v size=%d", p.Cache, p.CacheSize)
+	}
+}
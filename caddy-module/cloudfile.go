@@ -0,0 +1,92 @@
+package vibekanbanplugins
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultCloudURLFileInterval is how often CloudURLFile is checked for changes.
+const defaultCloudURLFileInterval = 5 * time.Second
+
+// readCloudURL reads the cloud URL from a file such as a Docker secret or
+// a mounted ConfigMap key.
+func readCloudURL(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return normalizeCloudURL(string(data)), nil
+}
+
+// setCloudURL swaps the handler's configured cloud URL and rebuilds its rule
+// set, keeping any runtime override applied. The previous URL is kept if the
+// new rule set can't be built.
+func (h *liveHandlers) setCloudURL(p *PluginInjector, cloudURL string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	previous := p.resolvedCloudURL
+	p.resolvedCloudURL = cloudURL
+	set, err := p.ruleSetFor(h.overrides[p.instanceName()])
+	if err != nil {
+		p.resolvedCloudURL = previous
+		return err
+	}
+	p.rules.current.Store(set)
+	return nil
+}
+
+// watchCloudURLFile polls the cloud URL file until ctx is done and swaps in
+// its contents when they change. Bad values are logged and the previous
+// cloud URL is kept.
+func (p *PluginInjector) watchCloudURLFile(ctx context.Context, seen string) {
+	interval := time.Duration(p.CloudURLFileInterval)
+	if interval <= 0 {
+		interval = defaultCloudURLFileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cloudURL, err := readCloudURL(p.cloudURLFile)
+		if err != nil {
+			if seen != "" {
+				p.logger.Error("reading cloud URL file, keeping previous cloud URL",
+					zap.String("file", p.cloudURLFile),
+					zap.Error(err))
+			}
+			seen = ""
+			continue
+		}
+		if cloudURL == seen {
+			continue
+		}
+		seen = cloudURL
+
+		if err := checkCloudURL(cloudURL); err != nil {
+			p.logger.Error("rejecting cloud URL from file, keeping previous cloud URL",
+				zap.String("file", p.cloudURLFile),
+				zap.Error(err))
+			continue
+		}
+		previous := p.currentRules().cloudURL
+		if err := handlers.setCloudURL(p, cloudURL); err != nil {
+			p.logger.Error("rejecting cloud URL from file, keeping previous cloud URL",
+				zap.String("file", p.cloudURLFile),
+				zap.Error(err))
+			continue
+		}
+		p.logger.Info("reloaded cloud URL from file",
+			zap.String("file", p.cloudURLFile),
+			zap.String("previous", previous),
+			zap.String("url", p.currentRules().cloudURL))
+	}
+}
@@ -0,0 +1,147 @@
+package vibekanbanplugins
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// writeCloudURLFile replaces the contents of the cloud URL file
+func writeCloudURLFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Failed to write cloud URL file: %v", err)
+	}
+}
+
+// waitForCloudURL polls until the injector's effective cloud URL is expected
+func waitForCloudURL(t *testing.T, injector *PluginInjector, expected string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for injector.currentRules().cloudURL != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected cloud URL %q, got %q", expected, injector.currentRules().cloudURL)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Verify changes to the cloud URL file are applied and bad values rejected
+func TestCloudURLFileReload(t *testing.T) {
+	// ARRANGE
+	path := filepath.Join(t.TempDir(), "vk_cloud_url")
+	writeCloudURLFile(t, path, "https://primary.example.com\n")
+	injector := &PluginInjector{
+		Name:                 "cloud-url-file",
+		CloudURLFile:         path,
+		CloudURLFileInterval: caddy.Duration(10 * time.Millisecond),
+	}
+	if err := injector.Provision(createTestContext(t)); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	t.Cleanup(func() { injector.Cleanup() })
+	js := `fetch("https://api.vibekanban.com/v1")`
+
+	// ASSERT
+	if got := rewriteWith(t, injector, js); got != `fetch("https://primary.example.com/v1")` {
+		t.Errorf("Expected cloud URL from file, got %q", got)
+	}
+
+	// ACT
+	writeCloudURLFile(t, path, "https://standby.example.com")
+
+	// ASSERT
+	waitForCloudURL(t, injector, "https://standby.example.com")
+	if got := rewriteWith(t, injector, js); got != `fetch("https://standby.example.com/v1")` {
+		t.Errorf("Expected reloaded cloud URL, got %q", got)
+	}
+
+	testCases := []struct {
+		name   string
+		change func()
+	}{
+		{"invalid URL", func() { writeCloudURLFile(t, path, "standby.example.com") }},
+		{"empty file", func() { writeCloudURLFile(t, path, "\n") }},
+		{"missing file", func() { os.Remove(path) }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ACT
+			tc.change()
+			time.Sleep(50 * time.Millisecond)
+
+			// ASSERT
+			if got := injector.currentRules().cloudURL; got != "https://standby.example.com" {
+				t.Errorf("Expected previous cloud URL to be kept, got %q", got)
+			}
+		})
+	}
+}
+
+// Verify the cloud URL file is checked at provision time
+func TestCloudURLFileProvision(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid")
+	writeCloudURLFile(t, valid, "https://vk.example.com")
+	invalid := filepath.Join(dir, "invalid")
+	writeCloudURLFile(t, invalid, "ftp://vk.example.com")
+
+	testCases := []struct {
+		name      string
+		injector  *PluginInjector
+		env       string
+		expectErr bool
+		expected  string
+	}{
+		{"file", &PluginInjector{CloudURLFile: valid}, "", false, "https://vk.example.com"},
+		{"env file", &PluginInjector{}, valid, false, "https://vk.example.com"},
+		{"cloud_url wins over env file", &PluginInjector{CloudURL: "https://other.example.com"}, valid, false, "https://other.example.com"},
+		{"both configured", &PluginInjector{CloudURL: "https://other.example.com", CloudURLFile: valid}, "", true, ""},
+		{"missing file", &PluginInjector{CloudURLFile: filepath.Join(dir, "missing")}, "", true, ""},
+		{"invalid contents", &PluginInjector{CloudURLFile: invalid}, "", true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			t.Setenv("VK_CLOUD_URL_FILE", tc.env)
+			t.Setenv("VK_CLOUD_URL", "")
+
+			// ACT
+			err := tc.injector.Provision(createTestContext(t))
+
+			// ASSERT
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected provisioning to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			t.Cleanup(func() { tc.injector.Cleanup() })
+			if got := tc.injector.currentRules().cloudURL; got != tc.expected {
+				t.Errorf("Expected cloud URL %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// Verify Caddyfile parsing of the cloud_url_file subdirective
+func TestUnmarshalCaddyfileCloudURLFile(t *testing.T) {
+	d := caddyfile.NewTestDispenser("vk_rewrite {\ncloud_url_file /run/secrets/vk_cloud_url 30s\n}")
+
+	var p PluginInjector
+	if err := p.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.CloudURLFile != "/run/secrets/vk_cloud_url" || time.Duration(p.CloudURLFileInterval) != 30*time.Second {
+		t.Errorf("Expected file and interval, got %q %v", p.CloudURLFile, p.CloudURLFileInterval)
+	}
+}
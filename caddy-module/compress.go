@@ -0,0 +1,215 @@
+package vibekanbanplugins
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// encodingIdentity is the variant served when the client accepts none of
+// the configured encodings.
+const encodingIdentity = "identity"
+
+// defaultCompress is the encoding preference used by a bare compress subdirective.
+var defaultCompress = []string{"br", "gzip"}
+
+// provisionCompress normalizes and validates the configured encodings, and
+// warns when the variants it produces won't be cached.
+func (p *PluginInjector) provisionCompress() error {
+	for i, enc := range p.Compress {
+		enc = normalizeEncoding(enc)
+		if !isSupportedEncoding(enc) {
+			return fmt.Errorf("compress: unsupported encoding %q", p.Compress[i])
+		}
+		p.Compress[i] = enc
+	}
+	if !p.Cache && p.logger != nil {
+		identity := false
+		for _, m := range p.matchers {
+			identity = identity || m.IdentityUpstream
+		}
+		if len(p.Compress) > 0 || identity {
+			p.logger.Warn("compressed variants are not cached without the cache subdirective; each response is compressed on every request",
+				zap.Strings("compress", p.Compress))
+		}
+	}
+	return nil
+}
+
+// negotiateEncoding picks the offered encoding the client prefers from an
+// Accept-Encoding value (RFC 9110 section 12.5.3). Ties go to the earlier
+// offered encoding; identity is returned when nothing offered is acceptable.
+func negotiateEncoding(acceptEncoding string, offered []string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = normalizeEncoding(name)
+		if name == "" {
+			continue
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		weight := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(param, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		if name == "*" {
+			wildcard = weight
+		} else {
+			weights[name] = weight
+		}
+	}
+
+	best, bestWeight := encodingIdentity, 0.0
+	for _, enc := range offered {
+		weight, ok := weights[enc]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestWeight {
+			best, bestWeight = enc, weight
+		}
+	}
+	return best
+}
+
+// variantFor returns the encoding variant to send a transformed response in
+// given the client's Accept-Encoding, or "" to keep the upstream coding.
+// Responses fetched as identity are always compressed by the module, with
+// the default preference if none is configured.
+func (p *PluginInjector) variantFor(acceptEncoding string, identity bool) string {
+	offered := p.Compress
+	if len(offered) == 0 {
+		if !identity {
+			return ""
+		}
+		offered = defaultCompress
+	}
+	return negotiateEncoding(acceptEncoding, offered)
+}
+
+// withIdentityUpstream asks upstream for an uncompressed response when an
+// opted-in matcher may transform the request.
+func (p *PluginInjector) withIdentityUpstream(r *http.Request) (*http.Request, bool) {
+	if !p.identityUpstream(r) {
+		return r, false
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("Accept-Encoding", encodingIdentity)
+	return r, true
+}
+
+// encodedStream is a streaming rewriter writing through an encoder; closing
+// it flushes the rewriter, then the encoder.
+type encodedStream struct {
+	io.WriteCloser
+	encoder io.WriteCloser
+}
+
+// Close implements io.Closer.
+func (s encodedStream) Close() error {
+	err := s.WriteCloser.Close()
+	if encErr := s.encoder.Close(); err == nil {
+		err = encErr
+	}
+	return err
+}
+
+// Flush flushes the rewriter's output through the encoder.
+func (s encodedStream) Flush() error {
+	return flushWriter(s.WriteCloser)
+}
+
+// newEncodedStream wraps a streaming rewriter so its output is encoded as the
+// variant. It returns the plain rewriter if the variant is identity or the
+// encoder can't be created, reporting whether the output is encoded.
+func (p *PluginInjector) newEncodedStream(r *http.Request, headers http.Header, dst io.Writer, variant string) (io.WriteCloser, bool) {
+	enc := variantEncoding(variant)
+	if enc == "" {
+		return p.newResponseStream(r, headers, dst), false
+	}
+	encoder, err := codecs[enc].newWriter(dst)
+	if err != nil {
+		p.rewriteFailed(r, stageEncode, err)
+		if p.logger != nil {
+			p.logger.Error("failed to create encoder, streaming uncompressed",
+				zap.String("encoding", enc),
+				zap.Error(err))
+		}
+		return p.newResponseStream(r, headers, dst), false
+	}
+	return encodedStream{WriteCloser: p.newResponseStream(r, headers, encoder), encoder: encoder}, true
+}
+
+// variantEncoding is the Content-Encoding a variant is sent with.
+func variantEncoding(variant string) string {
+	if variant == encodingIdentity {
+		return ""
+	}
+	return variant
+}
+
+// addVary adds a field to the Vary header unless it is already listed.
+func addVary(headers http.Header, field string) {
+	for _, value := range headers.Values("Vary") {
+		for _, listed := range strings.Split(value, ",") {
+			listed = strings.TrimSpace(listed)
+			if listed == "*" || strings.EqualFold(listed, field) {
+				return
+			}
+		}
+	}
+	headers.Add("Vary", field)
+}
+
+// compressBody decodes the upstream coding, transforms the body, and encodes
+// it as the variant. If the upstream body can't be decoded or the variant
+// can't be produced, it reports false along with what it could render.
+func (p *PluginInjector) compressBody(r *http.Request, headers http.Header, body []byte, variant string) (rendered, bool) {
+	upstream := contentCoding(headers)
+	identity := body
+	if upstream != "" {
+		decoded, err := decodeBody(upstream, body)
+		if err != nil {
+			p.metrics.skippedResponse(skipEncoding)
+			p.rewriteFailed(r, stageDecode, err)
+			if p.logger != nil {
+				p.logger.Warn("failed to decode response, passing through unchanged",
+					zap.String("encoding", upstream),
+					zap.Error(err))
+			}
+			return rendered{body: body, encoding: upstream}, false
+		}
+		identity = decoded
+	}
+
+	plain := headers.Clone()
+	plain.Del("Content-Encoding")
+	identity = p.processResponse(r, plain, identity)
+
+	if variant == encodingIdentity {
+		return rendered{body: identity}, true
+	}
+	encoded, err := encodeBody(variant, identity)
+	if err != nil {
+		p.rewriteFailed(r, stageEncode, err)
+		if p.logger != nil {
+			p.logger.Error("failed to compress rewritten response, sending it uncompressed",
+				zap.String("encoding", variant),
+				zap.Error(err))
+		}
+		return rendered{body: identity}, false
+	}
+	return rendered{body: encoded, encoding: variant}, true
+}
@@ -0,0 +1,330 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// Verify Accept-Encoding negotiation against the offered encodings
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"br", "gzip"}
+
+	testCases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", "identity"},
+		{"gzip, deflate, br, zstd", "br"},
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0, gzip;q=0", "identity"},
+		{"*", "br"},
+		{"*;q=0.1, br;q=0", "gzip"},
+		{"deflate", "identity"},
+		{"GZIP ; Q=1", "gzip"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			if got := negotiateEncoding(tc.acceptEncoding, offered); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// Verify Vary is extended without duplicating fields
+func TestAddVary(t *testing.T) {
+	headers := http.Header{"Vary": {"Origin, accept-encoding"}}
+	addVary(headers, "Accept-Encoding")
+	if got := strings.Join(headers.Values("Vary"), ", "); got != "Origin, accept-encoding" {
+		t.Errorf("Expected Vary unchanged, got %q", got)
+	}
+
+	headers = http.Header{"Vary": {"Origin"}}
+	addVary(headers, "Accept-Encoding")
+	if got := strings.Join(headers.Values("Vary"), ", "); got != "Origin, Accept-Encoding" {
+		t.Errorf("Expected Accept-Encoding appended, got %q", got)
+	}
+}
+
+// Verify rewritten responses are served in the client's preferred encoding
+func TestCompressedVariants(t *testing.T) {
+	original := []byte(`fetch("https://api.vibekanban.com/v1")`)
+	expected := `fetch("https://vk.example.com/v1")`
+	gzipped, err := encodeBody("gzip", original)
+	if err != nil {
+		t.Fatalf("encodeBody failed: %v", err)
+	}
+
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Compress: []string{"br", "gzip", "zstd"},
+		Cache:    true,
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		acceptEncoding   string
+		upstreamEncoding string
+		encoding         string
+	}{
+		{"brotli", "gzip, br", "", "br"},
+		{"gzip", "gzip", "", "gzip"},
+		{"zstd", "zstd", "", "zstd"},
+		{"identity", "", "", ""},
+		{"gzip upstream to brotli", "br, gzip", "gzip", "br"},
+		{"gzip upstream to identity", "identity", "gzip", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			body, headers := original, http.Header{
+				"Content-Type": []string{"application/javascript"},
+				"ETag":         []string{`"v1"`},
+			}
+			if tc.upstreamEncoding != "" {
+				body = gzipped
+				headers.Set("Content-Encoding", tc.upstreamEncoding)
+			}
+			upstream := mockNextHandler(body, 200, headers)
+			req := httptest.NewRequest("GET", "/assets/index.js", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if got := rec.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tc.encoding, got)
+			}
+			decoded := rec.Body.Bytes()
+			if tc.encoding != "" {
+				if decoded, err = decodeBody(tc.encoding, decoded); err != nil {
+					t.Fatalf("Body is not valid %s: %v", tc.encoding, err)
+				}
+			}
+			if string(decoded) != expected {
+				t.Errorf("Expected %q, got %q", expected, decoded)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+			}
+			etag := rec.Header().Get("ETag")
+			if !isDerivedETag(etag) {
+				t.Errorf("Expected derived ETag, got %q", etag)
+			}
+			if tc.encoding != "" && !strings.HasSuffix(etag, "-"+tc.encoding+`"`) {
+				t.Errorf("Expected ETag to name the %s variant, got %q", tc.encoding, etag)
+			}
+		})
+	}
+
+	// One entry per variant and upstream coding
+	if got := injector.cache.len(); got != len(testCases) {
+		t.Errorf("Expected %d cache entries, got %d", len(testCases), got)
+	}
+}
+
+// Verify a cached variant's ETag is answered with a 304
+func TestCompressedVariantNotModified(t *testing.T) {
+	// ARRANGE
+	upstream := mockNextHandler([]byte(`fetch("https://api.vibekanban.com")`), 200, http.Header{
+		"Content-Type": []string{"application/javascript"},
+		"ETag":         []string{`"v1"`},
+	})
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Compress: []string{"gzip"}}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	etag := rec.Header().Get("ETag")
+
+	// ACT
+	req = httptest.NewRequest("GET", "/assets/index.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("Expected 304, got %d", rec.Code)
+	}
+	if rec.Header().Get("ETag") != etag || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected ETag and Vary on 304, got %v", rec.Header())
+	}
+}
+
+// Verify a HEAD for a compressed variant doesn't claim the length of a
+// compressed empty body
+func TestCompressedVariantHead(t *testing.T) {
+	// ARRANGE
+	upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Content-Length", "35")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write([]byte(`fetch("https://api.vibekanban.com")`))
+		}
+		return nil
+	})
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Compress: []string{"gzip"}}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	req := httptest.NewRequest("HEAD", "/assets/index.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("Expected 200 without a body, got %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Expected no Content-Length, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip like the GET, got %q", got)
+	}
+}
+
+// Verify opted-in paths are fetched as identity and compressed on the way out
+func TestIdentityUpstream(t *testing.T) {
+	body := []byte(`fetch("https://api.vibekanban.com/v1")`)
+	expected := `fetch("https://vk.example.com/v1")`
+
+	testCases := []struct {
+		name     string
+		path     string
+		stream   bool
+		upstream string
+		encoding string
+	}{
+		{"opted-in asset", "/assets/index.js", false, "identity", "br"},
+		{"opted-in asset streamed", "/assets/index.js", true, "identity", "br"},
+		{"other path", "/vendor/lib.js", false, "gzip, br", ""},
+		{"not transformable", "/assets/logo.png", false, "gzip, br", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{
+				CloudURL: "https://vk.example.com",
+				Stream:   tc.stream,
+				Match: []ResponseMatcher{
+					{ContentTypes: []string{"javascript"}, Paths: []string{"/assets/*"}, IdentityUpstream: true},
+					{ContentTypes: []string{"javascript"}},
+				},
+			}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			var seen http.Header
+			upstream := conditionalUpstream(body, `"v1"`, &seen)
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("Accept-Encoding", "gzip, br")
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if got := seen.Get("Accept-Encoding"); got != tc.upstream {
+				t.Errorf("Expected upstream Accept-Encoding %q, got %q", tc.upstream, got)
+			}
+			if got := req.Header.Get("Accept-Encoding"); got != "gzip, br" {
+				t.Errorf("Client request was modified: %q", got)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tc.encoding, got)
+			}
+			if tc.encoding == "" {
+				return
+			}
+			decoded, err := decodeBody(tc.encoding, rec.Body.Bytes())
+			if err != nil {
+				t.Fatalf("Body is not valid %s: %v", tc.encoding, err)
+			}
+			if string(decoded) != expected {
+				t.Errorf("Expected %q, got %q", expected, decoded)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+			}
+			if etag := rec.Header().Get("ETag"); !strings.HasSuffix(etag, `-br"`) {
+				t.Errorf("Expected ETag to name the br variant, got %q", etag)
+			}
+		})
+	}
+}
+
+// Verify unsupported compress encodings are rejected
+func TestProvisionRejectsUnsupportedCompress(t *testing.T) {
+	injector := &PluginInjector{Compress: []string{"gzip", "deflate"}}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err == nil {
+		t.Error("Expected error for unsupported encoding, got nil")
+	}
+}
+
+// Verify Caddyfile parsing of the compress subdirective
+func TestUnmarshalCaddyfileCompress(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"compress", "br,gzip"},
+		{"compress zstd gzip", "zstd,gzip"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			d := caddyfile.NewTestDispenser("vk_rewrite {\n" + tc.input + "\n}")
+
+			var p PluginInjector
+			if err := p.UnmarshalCaddyfile(d); err != nil {
+				t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+			}
+			if got := strings.Join(p.Compress, ","); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package vibekanbanplugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// Paths the runtime config is served at.
+const (
+	configScriptPath = "/__vk/config.js"
+	configJSONPath   = "/__vk/config.json"
+)
+
+// clientConfigVersion is bumped on incompatible changes to the config shape.
+const clientConfigVersion = 1
+
+// RuntimeConfig enables window.__VK_CONFIG__ injection and sets values the
+// environment doesn't provide. Directive values win over VK_INSTANCE_NAME and
+// VK_FEATURES (a comma-separated list; a leading "-" turns a flag off).
+type RuntimeConfig struct {
+	// InstanceName is a display name for this VK deployment
+	InstanceName string `json:"instance_name,omitempty"`
+
+	// Features are feature flags exposed to the UI and plugins
+	Features map[string]bool `json:"features,omitempty"`
+}
+
+// clientConfig is the object exposed to the browser as window.__VK_CONFIG__.
+type clientConfig struct {
+	Version         int             `json:"version"`
+	CloudURL        string          `json:"cloudUrl,omitempty"`
+	InstanceName    string          `json:"instanceName,omitempty"`
+	Features        map[string]bool `json:"features"`
+	PluginsManifest string          `json:"pluginsManifest,omitempty"`
+}
+
+// provisionConfig merges environment and directive settings into the
+// resolved runtime config.
+func (p *PluginInjector) provisionConfig() error {
+	if p.Config == nil {
+		return nil
+	}
+
+	resolved := RuntimeConfig{
+		InstanceName: os.Getenv("VK_INSTANCE_NAME"),
+		Features:     make(map[string]bool),
+	}
+	for _, flag := range strings.Split(os.Getenv("VK_FEATURES"), ",") {
+		flag = strings.TrimSpace(flag)
+		name, disabled := strings.CutPrefix(flag, "-")
+		if name != "" {
+			resolved.Features[name] = !disabled
+		}
+	}
+
+	if p.Config.InstanceName != "" {
+		resolved.InstanceName = p.Config.InstanceName
+	}
+	for name, enabled := range p.Config.Features {
+		if name == "" {
+			return fmt.Errorf("config: empty feature name")
+		}
+		resolved.Features[name] = enabled
+	}
+
+	p.config = &resolved
+	return nil
+}
+
+// clientConfigFor builds the browser config for a request, expanding
+// placeholders in the cloud URL and instance name.
+func (p *PluginInjector) clientConfigFor(r *http.Request) clientConfig {
+	repl := requestReplacer(r)
+	cfg := clientConfig{
+		Version:      clientConfigVersion,
+		CloudURL:     repl.ReplaceKnown(p.servingRules(r).cloudURL, ""),
+		InstanceName: repl.ReplaceKnown(p.config.InstanceName, ""),
+		Features:     p.config.Features,
+	}
+	if p.PluginsDir != "" {
+		cfg.PluginsManifest = pluginsPath + pluginManifestName
+	}
+	return cfg
+}
+
+// configScript renders the config as a script assigning window.__VK_CONFIG__.
+// json.Marshal escapes <, > and &, so the result is safe inside a <script>.
+func (p *PluginInjector) configScript(r *http.Request) ([]byte, error) {
+	data, err := json.Marshal(p.clientConfigFor(r))
+	if err != nil {
+		return nil, err
+	}
+	return []byte("window.__VK_CONFIG__ = " + string(data) + ";\n"), nil
+}
+
+// configSnippet is the head-start injection defining window.__VK_CONFIG__
+// before any of the page's own scripts run.
+func (p *PluginInjector) configSnippet(r *http.Request) (htmlSnippet, error) {
+	script, err := p.configScript(r)
+	if err != nil {
+		return htmlSnippet{}, err
+	}
+	return htmlSnippet{at: injectHeadStart, html: "<script>" + string(script) + "</script>\n"}, nil
+}
+
+// servesConfig reports whether a request targets the config endpoints.
+func (p *PluginInjector) servesConfig(r *http.Request) bool {
+	return p.config != nil && (r.URL.Path == configScriptPath || r.URL.Path == configJSONPath)
+}
+
+// serveConfig answers /__vk/config.js and /__vk/config.json.
+func (p *PluginInjector) serveConfig(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return caddyhttp.Error(http.StatusMethodNotAllowed, nil)
+	}
+
+	var body []byte
+	var err error
+	if r.URL.Path == configScriptPath {
+		body, err = p.configScript(r)
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	} else {
+		body, err = json.Marshal(p.clientConfigFor(r))
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, err)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package vibekanbanplugins
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// Verify env settings are merged under directive settings
+func TestProvisionConfigMergesEnv(t *testing.T) {
+	// ARRANGE
+	t.Setenv("VK_INSTANCE_NAME", "from-env")
+	t.Setenv("VK_FEATURES", "boards, -beta ,timeline")
+
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Config: &RuntimeConfig{
+			InstanceName: "Team Board",
+			Features:     map[string]bool{"timeline": false, "shortcuts": true},
+		},
+	}
+
+	// ACT
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	cfg := injector.clientConfigFor(httptest.NewRequest("GET", "/", nil))
+
+	// ASSERT
+	if cfg.Version != clientConfigVersion {
+		t.Errorf("Expected version %d, got %d", clientConfigVersion, cfg.Version)
+	}
+	if cfg.CloudURL != "https://vk.example.com" {
+		t.Errorf("Unexpected cloud URL %q", cfg.CloudURL)
+	}
+	if cfg.InstanceName != "Team Board" {
+		t.Errorf("Expected directive instance name to win, got %q", cfg.InstanceName)
+	}
+	expected := map[string]bool{"boards": true, "beta": false, "timeline": false, "shortcuts": true}
+	if len(cfg.Features) != len(expected) {
+		t.Fatalf("Expected features %v, got %v", expected, cfg.Features)
+	}
+	for name, enabled := range expected {
+		if cfg.Features[name] != enabled {
+			t.Errorf("Feature %s: expected %v, got %v", name, enabled, cfg.Features[name])
+		}
+	}
+}
+
+// Verify window.__VK_CONFIG__ is injected at the start of <head>
+func TestInjectsRuntimeConfig(t *testing.T) {
+	// ARRANGE
+	html := []byte(`<html><head><script src="/assets/index.js"></script></head><body></body></html>`)
+	upstream := mockNextHandler(html, 200, http.Header{
+		"Content-Type": []string{"text/html"},
+	})
+
+	injector := &PluginInjector{
+		CloudURL:         "https://{http.request.host}/cloud",
+		DisableInjection: true,
+		Config:           &RuntimeConfig{InstanceName: "</script><b>x"},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := withReplacer(httptest.NewRequest("GET", "http://vk.tailnet.ts.net/", nil))
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	body := rec.Body.String()
+	prefix := `<html><head><script>window.__VK_CONFIG__ = {"version":1,"cloudUrl":"https://vk.tailnet.ts.net/cloud",` +
+		`"instanceName":"\u003c/script\u003e\u003cb\u003ex","features":{}};` + "\n</script>\n" +
+		`<script src="/assets/index.js">`
+	if !strings.HasPrefix(body, prefix) {
+		t.Errorf("Expected body to start with:\n%s\nGot:\n%s", prefix, body)
+	}
+}
+
+// Verify the config is served as JavaScript and JSON
+func TestServeRuntimeConfig(t *testing.T) {
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Config:   &RuntimeConfig{Features: map[string]bool{"shortcuts": true}},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	expectedJSON := `{"version":1,"cloudUrl":"https://vk.example.com","features":{"shortcuts":true}}`
+
+	testCases := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/__vk/config.json", "application/json", expectedJSON},
+		{"/__vk/config.js", "text/javascript; charset=utf-8", "window.__VK_CONFIG__ = " + expectedJSON + ";\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			upstream := mockNextHandler([]byte("upstream"), 200, http.Header{})
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if ct := rec.Header().Get("Content-Type"); ct != tc.contentType {
+				t.Errorf("Expected content type %q, got %q", tc.contentType, ct)
+			}
+			if rec.Body.String() != tc.body {
+				t.Errorf("Expected %q, got %q", tc.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+// Verify the config paths are proxied when config is not enabled
+func TestConfigPathWithoutConfig(t *testing.T) {
+	// ARRANGE
+	upstream := mockNextHandler([]byte("upstream"), 200, http.Header{
+		"Content-Type": []string{"text/plain"},
+	})
+
+	injector := &PluginInjector{}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/__vk/config.json", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if rec.Body.String() != "upstream" {
+		t.Errorf("Expected upstream response, got %q", rec.Body.String())
+	}
+}
+
+// Verify Caddyfile parsing of the config block
+func TestUnmarshalCaddyfileConfig(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		config {
+			instance_name "Team Board"
+			feature shortcuts
+			feature beta off
+		}
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.Config == nil {
+		t.Fatal("Expected config to be enabled")
+	}
+	got, _ := json.Marshal(p.Config)
+	expected := `{"instance_name":"Team Board","features":{"beta":false,"shortcuts":true}}`
+	if string(got) != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+// Verify invalid feature states are rejected
+func TestUnmarshalCaddyfileConfigErrors(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		config {
+			feature beta maybe
+		}
+	}`)
+
+	var p PluginInjector
+	if err := p.UnmarshalCaddyfile(d); err == nil {
+		t.Error("Expected error for invalid feature state, got nil")
+	}
+}
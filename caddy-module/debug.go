@@ -0,0 +1,100 @@
+package vibekanbanplugins
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// debugHeader lists the rules applied to a response and their counts when
+// Debug is enabled: "none" if nothing was replaced, "off" if the kill switch
+// bypassed rewriting. Streamed responses send it as a trailer.
+const debugHeader = "X-VK-Rewrite"
+
+// killSwitch is the query parameter and cookie that turn rewriting off
+// for a browser session in debug mode.
+const killSwitch = "vk_rewrite"
+
+// debugValue formats the tally for the debug header.
+func (s rewriteStats) debugValue() string {
+	if len(s.rules) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(s.rules))
+	for i, rule := range s.rules {
+		parts[i] = strconv.Quote(rule.from) + "=" + strconv.Itoa(rule.count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rewriteDisabled applies the debug kill switch: ?vk_rewrite=off turns
+// rewriting and injection off for the browser session with a cookie and
+// ?vk_rewrite=on turns them back on. It returns the request to send
+// upstream, without the parameter, and whether to bypass the handler.
+func (p *PluginInjector) rewriteDisabled(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !p.Debug {
+		return r, false
+	}
+
+	query := r.URL.Query()
+	if !query.Has(killSwitch) {
+		cookie, err := r.Cookie(killSwitch)
+		return r, err == nil && cookie.Value == "off"
+	}
+	off := query.Get(killSwitch) == "off"
+	cookie := &http.Cookie{Name: killSwitch, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	if off {
+		cookie.Value = "off"
+	} else {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+
+	query.Del(killSwitch)
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	r.RequestURI = r.URL.RequestURI()
+	return r, off
+}
+
+// bypassWriter marks responses served with rewriting switched off, and
+// keeps browsers from caching them in place of the rewritten assets.
+type bypassWriter struct {
+	*caddyhttp.ResponseWriterWrapper
+	wroteHeader bool
+}
+
+// newBypassWriter wraps w for a response served with rewriting off.
+func newBypassWriter(w http.ResponseWriter) *bypassWriter {
+	return &bypassWriter{ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w}}
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *bypassWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.Header()
+		header.Set("Cache-Control", "no-store")
+		header.Set(debugHeader, "off")
+	}
+	w.ResponseWriterWrapper.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter.
+func (w *bypassWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriterWrapper.Write(b)
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (w *bypassWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriterWrapper.ReadFrom(src)
+}
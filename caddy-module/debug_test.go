@@ -0,0 +1,176 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// Verify the debug header lists the rules applied to each response
+func TestDebugHeader(t *testing.T) {
+	js := `a("https://api.vibekanban.com");b("https://api.vibekanban.com")`
+
+	testCases := []struct {
+		name        string
+		debug       bool
+		stream      bool
+		path        string
+		contentType string
+		expected    string
+	}{
+		{"buffered", true, false, "/assets/index.js", "application/javascript", `"https://api.vibekanban.com"=2`},
+		{"streamed", true, true, "/assets/index.js", "application/javascript", `"https://api.vibekanban.com"=2`},
+		{"untouched", true, false, "/logo.png", "image/png", "none"},
+		{"debug off", false, false, "/assets/index.js", "application/javascript", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{CloudURL: "https://vk.example.com", Debug: tc.debug, Stream: tc.stream}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			upstream := mockNextHandler([]byte(js), 200, http.Header{"Content-Type": []string{tc.contentType}})
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			res := rec.Result()
+			got := res.Header.Get(debugHeader)
+			if tc.stream {
+				if !strings.Contains(res.Header.Get("Trailer"), debugHeader) {
+					t.Errorf("Expected %s to be declared as a trailer", debugHeader)
+				}
+				got = res.Trailer.Get(debugHeader)
+			}
+			if got != tc.expected {
+				t.Errorf("Expected %s %q, got %q", debugHeader, tc.expected, got)
+			}
+		})
+	}
+}
+
+// Verify the kill switch bypasses rewriting for the browser session
+func TestDebugKillSwitch(t *testing.T) {
+	original := `fetch("https://api.vibekanban.com/v1")`
+
+	testCases := []struct {
+		name      string
+		debug     bool
+		target    string
+		cookie    string
+		bypassed  bool
+		setCookie string
+		upstream  string
+	}{
+		{"switch off", true, "/assets/index.js?vk_rewrite=off&v=1", "", true, "vk_rewrite=off", "/assets/index.js?v=1"},
+		{"session cookie", true, "/assets/index.js", "off", true, "", "/assets/index.js"},
+		{"switch back on", true, "/assets/index.js?vk_rewrite=on", "off", false, "vk_rewrite=; Path=/; Max-Age=0", "/assets/index.js"},
+		{"not in debug mode", false, "/assets/index.js?vk_rewrite=off", "", false, "", "/assets/index.js?vk_rewrite=off"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{CloudURL: "https://vk.example.com", Debug: tc.debug}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			var seen string
+			upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				seen = r.URL.RequestURI()
+				w.Header().Set("Content-Type", "application/javascript")
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+				w.Write([]byte(original))
+				return nil
+			})
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: killSwitch, Value: tc.cookie})
+			}
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if seen != tc.upstream {
+				t.Errorf("Expected upstream to see %q, got %q", tc.upstream, seen)
+			}
+			if bypassed := rec.Body.String() == original; bypassed != tc.bypassed {
+				t.Errorf("Expected bypassed=%v, got body %q", tc.bypassed, rec.Body.String())
+			}
+			if tc.bypassed {
+				if rec.Header().Get("Cache-Control") != "no-store" || rec.Header().Get(debugHeader) != "off" {
+					t.Errorf("Expected uncacheable response marked off, got %v", rec.Header())
+				}
+			}
+			setCookie := rec.Header().Get("Set-Cookie")
+			if (tc.setCookie == "" && setCookie != "") || !strings.HasPrefix(setCookie, tc.setCookie) {
+				t.Errorf("Expected Set-Cookie %q, got %q", tc.setCookie, setCookie)
+			}
+		})
+	}
+}
+
+// Verify switching back on clears the session cookie on passthrough
+// responses that set cookies of their own
+func TestDebugKillSwitchWithUpstreamCookie(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Debug: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	upstream := mockNextHandler([]byte("png"), 200, http.Header{
+		"Content-Type": []string{"image/png"},
+		"Set-Cookie":   []string{"session=abc; Path=/"},
+	})
+	req := httptest.NewRequest("GET", "/logo.png?vk_rewrite=on", nil)
+	req.AddCookie(&http.Cookie{Name: killSwitch, Value: "off"})
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	if cookie := cookies[killSwitch]; cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("Expected the kill switch cookie to be deleted, got %v", rec.Header().Values("Set-Cookie"))
+	}
+	if cookie := cookies["session"]; cookie == nil || cookie.Value != "abc" {
+		t.Errorf("Expected upstream cookie to be kept, got %v", rec.Header().Values("Set-Cookie"))
+	}
+}
+
+// Verify Caddyfile parsing of the debug subdirective
+func TestUnmarshalCaddyfileDebug(t *testing.T) {
+	d := caddyfile.NewTestDispenser("vk_rewrite {\ndebug\n}")
+
+	var p PluginInjector
+	if err := p.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if !p.Debug {
+		t.Error("Expected debug to be enabled")
+	}
+}
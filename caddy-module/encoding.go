@@ -0,0 +1,115 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDecodedSize bounds how much a compressed body may expand to before we
+// give up rewriting it (guards against decompression bombs).
+const maxDecodedSize = 64 << 20
+
+// codec decodes and encodes a single HTTP content coding.
+type codec struct {
+	newReader func(io.Reader) (io.ReadCloser, error)
+	newWriter func(io.Writer) (io.WriteCloser, error)
+}
+
+// codecs lists the content codings we can decode, rewrite, and re-encode.
+var codecs = map[string]codec{
+	"gzip": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	},
+	"br": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(brotli.NewReader(r)), nil },
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+		},
+	},
+	"zstd": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return dec.IOReadCloser(), nil
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+	},
+}
+
+// normalizeEncoding returns the lowercased, trimmed Content-Encoding value.
+func normalizeEncoding(contentEncoding string) string {
+	return strings.ToLower(strings.TrimSpace(contentEncoding))
+}
+
+// contentCoding returns the normalized Content-Encoding of a response, or ""
+// for none. identity means no coding at all and is treated the same way.
+func contentCoding(headers http.Header) string {
+	enc := normalizeEncoding(headers.Get("Content-Encoding"))
+	if enc == "identity" {
+		return ""
+	}
+	return enc
+}
+
+// isSupportedEncoding reports whether the content coding can be round-tripped.
+func isSupportedEncoding(encoding string) bool {
+	_, ok := codecs[normalizeEncoding(encoding)]
+	return ok
+}
+
+// decodeBody decompresses body according to the given content coding.
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+	c, ok := codecs[normalizeEncoding(encoding)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	r, err := c.newReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > maxDecodedSize {
+		return nil, fmt.Errorf("decoded body exceeds %d bytes", maxDecodedSize)
+	}
+
+	return decoded, nil
+}
+
+// encodeBody compresses body with the given content coding.
+func encodeBody(encoding string, body []byte) ([]byte, error) {
+	c, ok := codecs[normalizeEncoding(encoding)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	var buf bytes.Buffer
+	w, err := c.newWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,131 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Verify every supported codec round-trips a body
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	original := []byte(`const api="https://api.vibekanban.com";`)
+
+	for encoding := range codecs {
+		t.Run(encoding, func(t *testing.T) {
+			// ACT
+			encoded, err := encodeBody(encoding, original)
+			if err != nil {
+				t.Fatalf("encodeBody failed: %v", err)
+			}
+			decoded, err := decodeBody(encoding, encoded)
+			if err != nil {
+				t.Fatalf("decodeBody failed: %v", err)
+			}
+
+			// ASSERT
+			if !bytes.Equal(decoded, original) {
+				t.Errorf("Expected %q, got %q", original, decoded)
+			}
+		})
+	}
+}
+
+// Verify encoded JavaScript is decoded, rewritten, and re-encoded with the same coding
+func TestRewritesEncodedJavaScript(t *testing.T) {
+	originalJS := []byte(`fetch("https://api.vibekanban.com/v1/projects");`)
+	expectedJS := []byte(`fetch("https://vk.example.com/v1/projects");`)
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		t.Run(encoding, func(t *testing.T) {
+			// ARRANGE
+			encoded, err := encodeBody(encoding, originalJS)
+			if err != nil {
+				t.Fatalf("encodeBody failed: %v", err)
+			}
+
+			upstream := mockNextHandler(encoded, 200, http.Header{
+				"Content-Type":     []string{"application/javascript"},
+				"Content-Encoding": []string{encoding},
+				"Content-Length":   []string{fmt.Sprintf("%d", len(encoded))},
+			})
+
+			injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/assets/index.js", nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT: Encoding is preserved
+			if got := rec.Header().Get("Content-Encoding"); got != encoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", encoding, got)
+			}
+
+			// ASSERT: Content-Length matches the re-encoded body
+			body := rec.Body.Bytes()
+			if got := rec.Header().Get("Content-Length"); got != fmt.Sprintf("%d", len(body)) {
+				t.Errorf("Content-Length mismatch: body is %d bytes, header says %s", len(body), got)
+			}
+
+			// ASSERT: Decoded body is rewritten
+			decoded, err := decodeBody(encoding, body)
+			if err != nil {
+				t.Fatalf("Response is not valid %s: %v", encoding, err)
+			}
+			if !bytes.Equal(decoded, expectedJS) {
+				t.Errorf("Expected %q, got %q", expectedJS, decoded)
+			}
+		})
+	}
+}
+
+// Verify bodies we cannot round-trip are passed through untouched
+func TestEncodedJavaScriptPassthrough(t *testing.T) {
+	testCases := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"unsupported encoding", "deflate", []byte{0x78, 0x9c, 0x03, 0x00}},
+		{"corrupt gzip", "gzip", []byte{0x1f, 0x8b, 0x08, 0x00, 0x00}},
+		{"stacked encodings", "gzip, br", []byte{0x1f, 0x8b}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			upstream := mockNextHandler(tc.body, 200, http.Header{
+				"Content-Type":     []string{"application/javascript"},
+				"Content-Encoding": []string{tc.encoding},
+			})
+
+			injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/assets/index.js", nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if !bytes.Equal(rec.Body.Bytes(), tc.body) {
+				t.Errorf("Expected body to be unchanged, got %v", rec.Body.Bytes())
+			}
+		})
+	}
+}
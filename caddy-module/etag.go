@@ -0,0 +1,303 @@
+package vibekanbanplugins
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// etagSuffix marks entity tags derived by this module: the upstream tag's
+// opaque value, etagSuffix, the transform tag, then "-" and the content
+// coding for compressed variants.
+const etagSuffix = "-vk"
+
+// transformTagLen is the length of the hex transform tag.
+const transformTagLen = 16
+
+// notModifiedHeaders are the headers a 304 response carries over from the
+// 200 it stands in for (RFC 9110 section 15.4.5).
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary"}
+
+// transformTag hashes everything that shapes a transformed body for this
+// request: the rules in scope (placeholders expanded), the injected snippets
+// and the runtime config. Changing any of them changes derived ETags.
+func (p *PluginInjector) transformTag(r *http.Request) string {
+	h := sha256.New()
+	for _, rule := range p.activeRules(r) {
+		fmt.Fprintf(h, "rule %t %q %q\n", rule.Regexp, rule.From, rule.to)
+	}
+	for _, s := range p.activeSnippets() {
+		fmt.Fprintf(h, "inject %s %q\n", s.at, s.html)
+	}
+	if p.Expect != nil && p.Expect.Banner {
+		fmt.Fprintf(h, "banner %q\n", p.Expect.Paths)
+	}
+	if p.config != nil {
+		cfg, _ := json.Marshal(p.clientConfigFor(r))
+		fmt.Fprintf(h, "config %s\n", cfg)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:transformTagLen]
+}
+
+// splitETag returns an entity tag's opaque value and whether it is weak.
+func splitETag(etag string) (opaque string, weak, ok bool) {
+	etag = strings.TrimSpace(etag)
+	if rest, found := strings.CutPrefix(etag, "W/"); found {
+		etag, weak = rest, true
+	}
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return "", false, false
+	}
+	opaque = etag[1 : len(etag)-1]
+	if strings.Contains(opaque, `"`) {
+		return "", false, false
+	}
+	return opaque, weak, true
+}
+
+// joinETag formats an opaque value as an entity tag.
+func joinETag(opaque string, weak bool) string {
+	if weak {
+		return `W/"` + opaque + `"`
+	}
+	return `"` + opaque + `"`
+}
+
+// deriveETag appends the transform tag, and the variant's coding if any,
+// to an upstream entity tag.
+func deriveETag(upstream, tag, variant string) (string, bool) {
+	opaque, weak, ok := splitETag(upstream)
+	if !ok {
+		return "", false
+	}
+	opaque += etagSuffix + tag
+	if enc := variantEncoding(variant); enc != "" {
+		opaque += "-" + enc
+	}
+	return joinETag(opaque, weak), true
+}
+
+// trimVariant strips a content-coding suffix from a derived opaque value.
+func trimVariant(opaque string) string {
+	if i := strings.LastIndexByte(opaque, '-'); i >= 0 && isSupportedEncoding(opaque[i+1:]) {
+		return opaque[:i]
+	}
+	return opaque
+}
+
+// isDerivedETag reports whether an entity tag was produced by deriveETag,
+// under any transform tag.
+func isDerivedETag(etag string) bool {
+	opaque, _, ok := splitETag(etag)
+	if !ok {
+		return false
+	}
+	opaque = trimVariant(opaque)
+	i := strings.LastIndex(opaque, etagSuffix)
+	if i < 0 || len(opaque)-i-len(etagSuffix) != transformTagLen {
+		return false
+	}
+	_, err := hex.DecodeString(opaque[i+len(etagSuffix):])
+	return err == nil
+}
+
+// upstreamETag reverses deriveETag for tags derived with the given transform tag.
+func upstreamETag(derived, tag string) (string, bool) {
+	opaque, weak, ok := splitETag(derived)
+	if !ok {
+		return "", false
+	}
+	base, found := strings.CutSuffix(trimVariant(opaque), etagSuffix+tag)
+	if !found {
+		return "", false
+	}
+	return joinETag(base, weak), true
+}
+
+// parseETagList splits an If-None-Match value into its entity tags,
+// respecting commas inside quoted values.
+func parseETagList(header string) []string {
+	var tags []string
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+		if header[0] == '*' {
+			tags = append(tags, "*")
+			header = header[1:]
+			continue
+		}
+		start := strings.IndexByte(header, '"')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(header[start+1:], '"')
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		tags = append(tags, strings.TrimSpace(header[:end]))
+		header = header[end:]
+	}
+	return tags
+}
+
+// etagListMatches reports whether an entity tag matches a parsed
+// If-None-Match list using weak comparison.
+func etagListMatches(list []string, etag string) bool {
+	opaque, _, ok := splitETag(etag)
+	if !ok {
+		return false
+	}
+	for _, candidate := range list {
+		if candidate == "*" {
+			return true
+		}
+		if o, _, ok := splitETag(candidate); ok && o == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// conditional is the per-request state for derived validators.
+type conditional struct {
+	// tag is the transform tag of the request's rule set, computed by
+	// transformTag on first use
+	tag string
+
+	// handler and req compute the transform tag
+	handler *PluginInjector
+	req     *http.Request
+
+	// clientTags is the client's original If-None-Match list
+	clientTags []string
+
+	// translated maps the opaque values of upstream tags sent in place of
+	// derived ones back to the client's tag
+	translated map[string]string
+}
+
+// prepareConditional rewrites If-None-Match so upstream sees its own
+// validators: current derived tags are translated back and stale derived tags
+// are dropped. On paths that may be transformed, plain upstream tags and
+// If-Modified-Since name an untransformed body (cached before the module was
+// deployed, or served with rewriting off) and are dropped too, so upstream
+// sends a full response to transform. The transform tag is only computed once
+// a derived tag or a transformed response needs it.
+func (p *PluginInjector) prepareConditional(r *http.Request) (*http.Request, *conditional) {
+	cond := &conditional{handler: p, req: r}
+	transformable := p.mayTransformPath(r)
+
+	header := strings.Join(r.Header.Values("If-None-Match"), ", ")
+	if header == "" {
+		if transformable && r.Header.Get("If-Modified-Since") != "" {
+			r = r.Clone(r.Context())
+			r.Header.Del("If-Modified-Since")
+		}
+		return r, cond
+	}
+	cond.clientTags = parseETagList(header)
+
+	var upstream []string
+	changed := false
+	for _, etag := range cond.clientTags {
+		if !isDerivedETag(etag) {
+			if transformable && etag != "*" {
+				changed = true
+				continue
+			}
+			upstream = append(upstream, etag)
+			continue
+		}
+		changed = true
+		if original, ok := upstreamETag(etag, cond.transformTag()); ok {
+			if cond.translated == nil {
+				cond.translated = make(map[string]string)
+			}
+			opaque, _, _ := splitETag(original)
+			cond.translated[opaque] = etag
+			upstream = append(upstream, original)
+		}
+	}
+	if !changed {
+		return r, cond
+	}
+
+	r = r.Clone(r.Context())
+	if len(upstream) == 0 {
+		r.Header.Del("If-None-Match")
+	} else {
+		r.Header.Set("If-None-Match", strings.Join(upstream, ", "))
+	}
+	// The client's date validator belongs to the transformed body too
+	r.Header.Del("If-Modified-Since")
+	return r, cond
+}
+
+// transformTag returns the request's transform tag, hashing the rule set
+// the first time it is needed.
+func (c *conditional) transformTag() string {
+	if c.tag == "" {
+		c.tag = c.handler.transformTag(c.req)
+	}
+	return c.tag
+}
+
+// derive replaces the upstream validators of a transformed response with a
+// derived ETag for the variant and drops Last-Modified. It reports whether an
+// ETag was derived.
+func (c *conditional) derive(headers http.Header, variant string) bool {
+	headers.Del("Last-Modified")
+	etag := headers.Get("ETag")
+	if etag == "" {
+		return false
+	}
+	derived, ok := deriveETag(etag, c.transformTag(), variant)
+	if !ok {
+		headers.Del("ETag")
+		return false
+	}
+	headers.Set("ETag", derived)
+	return true
+}
+
+// notModified reports whether the client already holds the transformed
+// response described by headers.
+func (c *conditional) notModified(r *http.Request, statusCode int, headers http.Header) bool {
+	if statusCode != http.StatusOK || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	return etagListMatches(c.clientTags, headers.Get("ETag"))
+}
+
+// reviveNotModified restores the client's derived ETag on an upstream 304
+// answering a translated validator.
+func (c *conditional) reviveNotModified(statusCode int, headers http.Header) {
+	if statusCode != http.StatusNotModified {
+		return
+	}
+	opaque, _, ok := splitETag(headers.Get("ETag"))
+	if !ok {
+		return
+	}
+	if derived, found := c.translated[opaque]; found {
+		headers.Del("Last-Modified")
+		headers.Set("ETag", derived)
+	}
+}
+
+// writeNotModified answers with a 304 carrying the validator headers of the
+// response it replaces.
+func writeNotModified(w http.ResponseWriter, headers http.Header) {
+	for _, key := range notModifiedHeaders {
+		if values := headers.Values(key); len(values) > 0 {
+			w.Header()[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
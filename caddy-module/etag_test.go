@@ -0,0 +1,251 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// conditionalUpstream mimics an origin honouring If-None-Match for one asset.
+func conditionalUpstream(body []byte, etag string, seen *http.Header) caddyhttp.Handler {
+	return caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if seen != nil {
+			*seen = r.Header.Clone()
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagListMatches(parseETagList(r.Header.Get("If-None-Match")), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		return nil
+	})
+}
+
+// Verify entity tag helpers
+func TestETagHelpers(t *testing.T) {
+	tag := "0123456789abcdef"
+
+	derived, ok := deriveETag(`W/"abc"`, tag, "")
+	if !ok || derived != `W/"abc-vk0123456789abcdef"` {
+		t.Errorf("Unexpected derived tag %q", derived)
+	}
+	if original, ok := upstreamETag(derived, tag); !ok || original != `W/"abc"` {
+		t.Errorf("Expected to recover upstream tag, got %q", original)
+	}
+	if _, ok := upstreamETag(derived, "fedcba9876543210"); ok {
+		t.Error("Expected a different transform tag not to match")
+	}
+	if !isDerivedETag(derived) || isDerivedETag(`"abc-vk"`) || isDerivedETag(`"abc"`) {
+		t.Error("isDerivedETag misclassified a tag")
+	}
+	variant, _ := deriveETag(`"abc"`, tag, "br")
+	if variant != `"abc-vk0123456789abcdef-br"` || !isDerivedETag(variant) {
+		t.Errorf("Unexpected variant tag %q", variant)
+	}
+	if original, ok := upstreamETag(variant, tag); !ok || original != `"abc"` {
+		t.Errorf("Expected to recover upstream tag from variant, got %q", original)
+	}
+	if _, ok := deriveETag("abc", tag, ""); ok {
+		t.Error("Expected unquoted tag to be rejected")
+	}
+
+	list := parseETagList(` "a,b", W/"c" ,* `)
+	if strings.Join(list, "|") != `"a,b"|W/"c"|*` {
+		t.Errorf("Unexpected parsed list %q", list)
+	}
+	if !etagListMatches([]string{`W/"x"`}, `"x"`) {
+		t.Error("Expected weak comparison to match")
+	}
+}
+
+// Verify the ETag changes with the rule set and Last-Modified is dropped
+func TestDerivedETag(t *testing.T) {
+	body := []byte(`fetch("https://api.vibekanban.com/v1")`)
+
+	etagFor := func(cloudURL string) (string, http.Header) {
+		injector := &PluginInjector{CloudURL: cloudURL}
+		ctx := createTestContext(t)
+		if err := injector.Provision(ctx); err != nil {
+			t.Fatalf("Failed to provision injector: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/assets/index.js", nil)
+		rec := httptest.NewRecorder()
+		if err := injector.ServeHTTP(rec, req, conditionalUpstream(body, `"v1"`, nil)); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+		return rec.Header().Get("ETag"), rec.Header()
+	}
+
+	// ACT
+	first, headers := etagFor("https://vk.example.com")
+	again, _ := etagFor("https://vk.example.com")
+	other, _ := etagFor("https://vk.other.example.com")
+
+	// ASSERT
+	if !strings.HasPrefix(first, `"v1-vk`) || !isDerivedETag(first) {
+		t.Errorf("Expected derived ETag, got %q", first)
+	}
+	if first != again {
+		t.Errorf("Expected stable ETag, got %q then %q", first, again)
+	}
+	if first == other {
+		t.Error("Expected ETag to change with the cloud URL")
+	}
+	if headers.Get("Last-Modified") != "" {
+		t.Error("Expected Last-Modified to be dropped from rewritten response")
+	}
+}
+
+// Verify If-None-Match with a derived tag yields a 304 from either side
+func TestConditionalRequests(t *testing.T) {
+	body := []byte(`fetch("https://api.vibekanban.com/v1")`)
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	// Fetch once to learn the derived ETag
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	rec := httptest.NewRecorder()
+	if err := injector.ServeHTTP(rec, req, conditionalUpstream(body, `"v1"`, nil)); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	derived := rec.Header().Get("ETag")
+	stale := `"v1-vk0000000000000000"`
+
+	testCases := []struct {
+		name         string
+		ifNoneMatch  string
+		upstreamETag string
+		upstreamINM  string
+		status       int
+	}{
+		{"upstream unchanged", derived, `"v1"`, `"v1"`, http.StatusNotModified},
+		{"upstream ignores validator", derived, `"v1"`, `"v1"`, http.StatusNotModified},
+		{"upstream changed", derived, `"v2"`, `"v1"`, http.StatusOK},
+		{"stale rule set", stale, `"v1"`, "", http.StatusOK},
+		{"mixed list", `"other", ` + stale, `"v1"`, "", http.StatusOK},
+		{"plain upstream tag", `"v1"`, `"v1"`, "", http.StatusOK},
+		{"derived and plain tags", `"v0", ` + derived, `"v1"`, `"v1"`, http.StatusNotModified},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			var seen http.Header
+			upstream := conditionalUpstream(body, tc.upstreamETag, &seen)
+			if tc.name == "upstream ignores validator" {
+				upstream = mockNextHandler(body, 200, http.Header{
+					"Content-Type": []string{"application/javascript"},
+					"ETag":         []string{tc.upstreamETag},
+				})
+			}
+			req := httptest.NewRequest("GET", "/assets/index.js", nil)
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			req.Header.Set("If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT")
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if rec.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if seen != nil {
+				if got := seen.Get("If-None-Match"); got != tc.upstreamINM {
+					t.Errorf("Expected upstream If-None-Match %q, got %q", tc.upstreamINM, got)
+				}
+				if seen.Get("If-Modified-Since") != "" {
+					t.Error("Expected If-Modified-Since to be stripped")
+				}
+			}
+			etag := rec.Header().Get("ETag")
+			if !isDerivedETag(etag) {
+				t.Errorf("Expected derived ETag, got %q", etag)
+			}
+			if tc.status == http.StatusNotModified {
+				if etag != derived {
+					t.Errorf("Expected ETag %q, got %q", derived, etag)
+				}
+				if rec.Body.Len() != 0 {
+					t.Errorf("304 must not have a body, got %q", rec.Body.String())
+				}
+			} else if !strings.Contains(rec.Body.String(), "https://vk.example.com") {
+				t.Errorf("Expected rewritten body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+// Verify the transform tag is only computed when a validator needs it
+func TestTransformTagComputedLazily(t *testing.T) {
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	// Requests without derived tags don't hash the rule set
+	req := httptest.NewRequest("GET", "/images/logo.png", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	_, cond := injector.prepareConditional(req)
+	if cond.tag != "" {
+		t.Errorf("Expected no transform tag before it is needed, got %q", cond.tag)
+	}
+
+	// A derived tag is translated with the current transform tag
+	expected := injector.transformTag(req)
+	req.Header.Set("If-None-Match", `"v1-vk`+expected+`"`)
+	upstreamReq, cond := injector.prepareConditional(req)
+	if cond.tag != expected {
+		t.Errorf("Expected transform tag %q, got %q", expected, cond.tag)
+	}
+	if got := upstreamReq.Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("Expected upstream If-None-Match %q, got %q", `"v1"`, got)
+	}
+}
+
+// Verify a date validator alone is dropped only on transformable paths
+func TestIfModifiedSinceDroppedForTransformablePaths(t *testing.T) {
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		kept bool
+	}{
+		{"/assets/index.js", false},
+		{"/images/logo.png", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT")
+
+			upstreamReq, _ := injector.prepareConditional(req)
+
+			if kept := upstreamReq.Header.Get("If-Modified-Since") != ""; kept != tc.kept {
+				t.Errorf("Expected If-Modified-Since kept=%v, got %v", tc.kept, kept)
+			}
+			if req.Header.Get("If-Modified-Since") == "" {
+				t.Error("Expected the client's request to be left unchanged")
+			}
+		})
+	}
+}
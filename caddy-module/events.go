@@ -0,0 +1,117 @@
+package vibekanbanplugins
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// Events emitted over a response's rewrite lifecycle, for subscribers of
+// Caddy's events app.
+const (
+	// eventApplied: rules replaced something or snippets were injected
+	eventApplied = "vk.rewrite.applied"
+
+	// eventSkippedEncoded: a response was passed through because its
+	// content coding can't be rewritten
+	eventSkippedEncoded = "vk.rewrite.skipped_encoded"
+
+	// eventZeroMatch: a response the expect_rewrites canary covers got
+	// fewer replacements than expected
+	eventZeroMatch = "vk.rewrite.zero_match"
+
+	// eventError: a rewrite step failed and the response was served
+	// untransformed or in a fallback form
+	eventError = "vk.rewrite.error"
+)
+
+// Events emitted when the health check finds the cloud unreachable and
+// when it comes back.
+const (
+	eventCloudDown = "vk.rewrite.cloud_down"
+	eventCloudUp   = "vk.rewrite.cloud_up"
+)
+
+// Steps of a rewrite reported in vk.rewrite.error events.
+const (
+	stageDecode = "decode"
+	stageEncode = "encode"
+	stageConfig = "config"
+)
+
+// eventEmitter is the part of Caddy's events app the handler uses.
+type eventEmitter interface {
+	Emit(ctx caddy.Context, eventName string, data map[string]any) caddy.Event
+}
+
+// provisionEvents looks up the events app. The http app loads it before
+// provisioning handlers; without it (e.g. in tests) events are not emitted.
+func (p *PluginInjector) provisionEvents(ctx caddy.Context) error {
+	p.ctx = ctx
+	app, err := ctx.AppIfConfigured("events")
+	if errors.Is(err, caddy.ErrNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting events app: %v", err)
+	}
+	if events, ok := app.(eventEmitter); ok {
+		p.events = events
+	}
+	return nil
+}
+
+// emit publishes a Caddy event if the events app is available.
+func (p *PluginInjector) emit(name string, data map[string]any) {
+	if p.events == nil {
+		return
+	}
+	p.events.Emit(p.ctx, name, data)
+}
+
+// emitApplied reports the replacements each rule made in a response, if
+// anything was changed.
+func (p *PluginInjector) emitApplied(r *http.Request, mode string, rules []*activeRule, injected bool) {
+	if p.events == nil {
+		return
+	}
+	total := 0
+	counts := make(map[string]any)
+	for _, rule := range rules {
+		if rule.count > 0 {
+			total += rule.count
+			counts[rule.From] = rule.count
+		}
+	}
+	if total == 0 && !injected {
+		return
+	}
+	p.emit(eventApplied, map[string]any{
+		"path":         r.URL.Path,
+		"mode":         mode,
+		"replacements": total,
+		"rules":        counts,
+		"injected":     injected,
+	})
+}
+
+// skippedEncoded records a response passed through because its content
+// coding can't be rewritten.
+func (p *PluginInjector) skippedEncoded(r *http.Request, encoding string) {
+	p.metrics.skippedResponse(skipEncoding)
+	p.emit(eventSkippedEncoded, map[string]any{
+		"path":     r.URL.Path,
+		"encoding": encoding,
+	})
+}
+
+// rewriteFailed reports a failed rewrite step.
+func (p *PluginInjector) rewriteFailed(r *http.Request, stage string, err error) {
+	p.emit(eventError, map[string]any{
+		"path":  r.URL.Path,
+		"stage": stage,
+		"error": err.Error(),
+	})
+}
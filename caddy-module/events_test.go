@@ -0,0 +1,231 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recordedEvents captures events in place of Caddy's events app.
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+type recordedEvent struct {
+	name string
+	data map[string]any
+}
+
+// Emit implements eventEmitter.
+func (e *recordedEvents) Emit(ctx caddy.Context, name string, data map[string]any) caddy.Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, recordedEvent{name, data})
+	return caddy.Event{}
+}
+
+// named returns the recorded events with the given name.
+func (e *recordedEvents) named(name string) []recordedEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []recordedEvent
+	for _, ev := range e.events {
+		if ev.name == name {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// Verify rewrite lifecycle events carry what happened to each response
+func TestRewriteEvents(t *testing.T) {
+	js := `a("https://api.vibekanban.com");b("https://api.vibekanban.com")`
+
+	testCases := []struct {
+		name     string
+		path     string
+		stream   bool
+		body     string
+		headers  http.Header
+		event    string
+		expected map[string]any
+	}{
+		{
+			name:    "buffered rewrite",
+			path:    "/assets/index.js",
+			body:    js,
+			headers: http.Header{"Content-Type": {"application/javascript"}},
+			event:   eventApplied,
+			expected: map[string]any{
+				"path": "/assets/index.js", "mode": "buffer", "replacements": 2, "injected": false,
+			},
+		},
+		{
+			name:    "streamed rewrite",
+			path:    "/assets/index.js",
+			stream:  true,
+			body:    js,
+			headers: http.Header{"Content-Type": {"application/javascript"}},
+			event:   eventApplied,
+			expected: map[string]any{
+				"path": "/assets/index.js", "mode": "stream", "replacements": 2, "injected": false,
+			},
+		},
+		{
+			name:    "page injection",
+			path:    "/",
+			body:    "<html><head></head><body></body></html>",
+			headers: http.Header{"Content-Type": {"text/html"}},
+			event:   eventApplied,
+			expected: map[string]any{
+				"path": "/", "mode": "buffer", "replacements": 0, "injected": true,
+			},
+		},
+		{
+			name: "unsupported encoding",
+			path: "/assets/index.js",
+			body: js,
+			headers: http.Header{
+				"Content-Type":     {"application/javascript"},
+				"Content-Encoding": {"x-custom"},
+			},
+			event:    eventSkippedEncoded,
+			expected: map[string]any{"path": "/assets/index.js", "encoding": "x-custom"},
+		},
+		{
+			name: "corrupt gzip",
+			path: "/assets/index.js",
+			body: "not gzip",
+			headers: http.Header{
+				"Content-Type":     {"application/javascript"},
+				"Content-Encoding": {"gzip"},
+			},
+			event:    eventError,
+			expected: map[string]any{"path": "/assets/index.js", "stage": "decode"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{CloudURL: "https://vk.example.com", Stream: tc.stream}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			events := &recordedEvents{}
+			injector.events = events
+			upstream := mockNextHandler([]byte(tc.body), 200, tc.headers)
+			req := httptest.NewRequest("GET", tc.path, nil)
+
+			// ACT
+			if err := injector.ServeHTTP(httptest.NewRecorder(), req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if len(events.events) != 1 {
+				t.Fatalf("Expected exactly one event, got %+v", events.events)
+			}
+			got := events.named(tc.event)
+			if len(got) != 1 {
+				t.Fatalf("Expected %s event, got %+v", tc.event, events.events)
+			}
+			for key, want := range tc.expected {
+				if got[0].data[key] != want {
+					t.Errorf("Expected %s=%v, got %v", key, want, got[0].data[key])
+				}
+			}
+			if tc.event == eventApplied && tc.expected["replacements"] != 0 {
+				rules, _ := got[0].data["rules"].(map[string]any)
+				if rules[officialCloudURL] != 2 {
+					t.Errorf("Expected per-rule count for %s, got %v", officialCloudURL, rules)
+				}
+			}
+		})
+	}
+}
+
+// Verify untouched responses emit nothing
+func TestNoEventsForUntouchedResponses(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	events := &recordedEvents{}
+	injector.events = events
+	upstream := mockNextHandler([]byte(`a("https://example.com")`), 200, http.Header{
+		"Content-Type": []string{"application/javascript"},
+	})
+
+	// ACT
+	err := injector.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/assets/index.js", nil), upstream)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	if len(events.events) != 0 {
+		t.Errorf("Expected no events, got %+v", events.events)
+	}
+}
+
+// Verify unsupported codings are only reported on responses that would have
+// been transformed, and identity counts as no coding
+func TestSkippedEncodedOnlyForTransformableResponses(t *testing.T) {
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		encoding    string
+		skipped     int
+		body        string
+	}{
+		{"matched script", "/assets/index.js", "application/javascript", "x-custom", 1, `a("https://api.vibekanban.com")`},
+		{"image", "/logo.png", "image/png", "x-custom", 0, `a("https://api.vibekanban.com")`},
+		{"font", "/fonts/inter.woff2", "font/woff2", "x-custom", 0, `a("https://api.vibekanban.com")`},
+		{"identity script", "/assets/index.js", "application/javascript", "identity", 0, `a("https://vk.example.com")`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			events := &recordedEvents{}
+			injector.events = events
+			upstream := mockNextHandler([]byte(`a("https://api.vibekanban.com")`), 200, http.Header{
+				"Content-Type":     []string{tc.contentType},
+				"Content-Encoding": []string{tc.encoding},
+			})
+			rec := httptest.NewRecorder()
+
+			// ACT
+			err := injector.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil), upstream)
+
+			// ASSERT
+			if err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+			if got := len(events.named(eventSkippedEncoded)); got != tc.skipped {
+				t.Errorf("Expected %d skipped_encoded events, got %d", tc.skipped, got)
+			}
+			if got := testutil.ToFloat64(injector.metrics.skipped.WithLabelValues(skipEncoding)); got != float64(tc.skipped) {
+				t.Errorf("Expected %d encoding skips, got %v", tc.skipped, got)
+			}
+			if rec.Body.String() != tc.body {
+				t.Errorf("Expected body %q, got %q", tc.body, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package vibekanbanplugins
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// rewriteBanner is the warning appended to responses that fail the canary
+// when Banner is set.
+//
+//go:embed assets/rewrite-banner.js
+var rewriteBanner string
+
+// RewriteExpectation is a canary for responses the rules must change, such
+// as the main bundle embedding the official cloud URL. A release that embeds
+// the URL differently would otherwise pass through unchanged, silently
+// pointing the app at the public cloud.
+type RewriteExpectation struct {
+	// Paths are the request paths (globs) of the responses expected to be rewritten
+	Paths []string `json:"paths,omitempty"`
+
+	// Min is the fewest replacements each such response must get (default 1)
+	Min int `json:"min,omitempty"`
+
+	// Banner makes a failing page show a visible warning
+	Banner bool `json:"banner,omitempty"`
+
+	paths caddyhttp.MatchPath
+}
+
+// provision validates the expectation and compiles its paths.
+func (e *RewriteExpectation) provision(ctx caddy.Context) error {
+	if len(e.Paths) == 0 {
+		return fmt.Errorf("at least one path is required")
+	}
+	if e.Min < 0 {
+		return fmt.Errorf("min must not be negative")
+	}
+	if e.Min == 0 {
+		e.Min = 1
+	}
+	return provisionPaths(ctx, e.Paths, &e.paths)
+}
+
+// checkExpectation reports a response the canary covers that got fewer than
+// the expected replacements. It returns false if the expectation failed.
+func (p *PluginInjector) checkExpectation(r *http.Request, count int) bool {
+	e := p.Expect
+	if e == nil || count >= e.Min || !matchPaths(e.paths, r) {
+		return true
+	}
+	if p.logger != nil {
+		p.logger.Error("expected rewrites missing from response; clients may be using the public cloud",
+			zap.String("path", r.URL.Path),
+			zap.Int("replacements", count),
+			zap.Int("min", e.Min))
+	}
+	p.emit(eventZeroMatch, map[string]any{
+		"path":         r.URL.Path,
+		"replacements": count,
+		"min":          e.Min,
+	})
+	return false
+}
+
+// bannerFor returns the warning to add to a failing response: a script to
+// append to JavaScript, or a snippet to inject into HTML.
+func (p *PluginInjector) bannerFor(headers http.Header) (js string, snippet *htmlSnippet) {
+	if p.Expect == nil || !p.Expect.Banner {
+		return "", nil
+	}
+	if isHTML(headers) {
+		return "", &htmlSnippet{at: injectBodyEnd, html: "<script>\n" + rewriteBanner + "</script>\n"}
+	}
+	if isJavaScript(headers) {
+		return "\n;" + rewriteBanner, nil
+	}
+	return "", nil
+}
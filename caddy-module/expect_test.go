@@ -0,0 +1,114 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// Verify responses missing expected rewrites raise an event and a banner
+func TestExpectRewrites(t *testing.T) {
+	rewritable := `fetch("https://api.vibekanban.com/v1")`
+	moved := `fetch(base + "/v1")`
+	page := "<html><head></head><body><p>app</p></body></html>"
+
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		banner      bool
+		stream      bool
+		failed      bool
+		shown       bool
+	}{
+		{"bundle rewritten", "/assets/index-abc.js", "application/javascript", rewritable, true, false, false, false},
+		{"bundle unchanged", "/assets/index-abc.js", "application/javascript", moved, true, false, true, true},
+		{"bundle unchanged without banner", "/assets/index-abc.js", "application/javascript", moved, false, false, true, false},
+		{"bundle unchanged streamed", "/assets/index-abc.js", "application/javascript", moved, true, true, true, true},
+		{"other chunk", "/assets/vendor.js", "application/javascript", moved, true, false, false, false},
+		{"page unchanged", "/", "text/html; charset=utf-8", page, true, false, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{
+				CloudURL:         "https://vk.example.com",
+				Stream:           tc.stream,
+				DisableInjection: true,
+				Match: []ResponseMatcher{
+					{ContentTypes: []string{"javascript", "text/html"}},
+				},
+				Expect: &RewriteExpectation{Paths: []string{"/assets/index-*.js", "/"}, Banner: tc.banner},
+			}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			events := &recordedEvents{}
+			injector.events = events
+			upstream := mockNextHandler([]byte(tc.body), 200, http.Header{
+				"Content-Type": []string{tc.contentType},
+			})
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			failures := events.named(eventZeroMatch)
+			if tc.failed != (len(failures) == 1) {
+				t.Fatalf("Expected failure=%v, got %d events", tc.failed, len(failures))
+			}
+			if tc.failed && (failures[0].data["path"] != tc.path || failures[0].data["min"] != 1) {
+				t.Errorf("Unexpected event data %v", failures[0].data)
+			}
+			body := rec.Body.String()
+			if shown := strings.Contains(body, "vk-rewrite-warning"); shown != tc.shown {
+				t.Errorf("Expected banner shown=%v, got body %q", tc.shown, body)
+			}
+			if tc.shown && strings.Contains(tc.contentType, "html") && !strings.HasSuffix(body, "</script>\n</body></html>") {
+				t.Errorf("Expected banner script before </body>, got %q", body)
+			}
+		})
+	}
+}
+
+// Verify expect_rewrites needs paths
+func TestProvisionRejectsExpectWithoutPaths(t *testing.T) {
+	injector := &PluginInjector{Expect: &RewriteExpectation{Banner: true}}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err == nil {
+		t.Error("Expected error for expectation without paths, got nil")
+	}
+}
+
+// Verify Caddyfile parsing of the expect_rewrites subdirective
+func TestUnmarshalCaddyfileExpectRewrites(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		expect_rewrites 2 {
+			path /assets/index-*.js
+			banner
+		}
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.Expect == nil || p.Expect.Min != 2 || !p.Expect.Banner || len(p.Expect.Paths) != 1 {
+		t.Errorf("Unexpected expectation %+v", p.Expect)
+	}
+}
@@ -1,20 +1,25 @@
 // Package vibekanbanplugins implements a Caddy HTTP handler that rewrites
-// Vibe Kanban API URLs in JavaScript responses to point to a custom cloud instance.
+// Vibe Kanban API URLs in JavaScript and other text responses to point to a
+// custom cloud instance.
 package vibekanbanplugins
 
 import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/dustin/go-humanize"
 	"go.uber.org/zap"
 )
 
@@ -24,14 +29,139 @@ func init() {
 	httpcaddyfile.RegisterDirectiveOrder("vk_rewrite", "before", "reverse_proxy")
 }
 
-// PluginInjector rewrites Vibe Kanban API URLs in JavaScript responses.
+// PluginInjector rewrites Vibe Kanban API URLs in JavaScript, HTML and other text responses.
 type PluginInjector struct {
+	// Name identifies the handler in the admin API (default "default");
+	// handlers sharing a name are updated together
+	Name string `json:"name,omitempty"`
+
 	// CloudURL is the URL of the self-hosted VK cloud instance (reads from env if not set)
 	CloudURL string `json:"cloud_url,omitempty"`
 
+	// CloudURLs lists candidate cloud instances in order of preference, in
+	// place of CloudURL. With a HealthCheck, requests use the first that is
+	// up, and each browser session stays on the cloud it was first served.
+	CloudURLs []string `json:"cloud_urls,omitempty"`
+
+	// CloudURLFile is a file holding the cloud URL, such as a Docker secret
+	// or a mounted ConfigMap key (default: VK_CLOUD_URL_FILE env var). It is
+	// watched and changes are applied without a reload.
+	CloudURLFile string `json:"cloud_url_file,omitempty"`
+
+	// CloudURLFileInterval is how often CloudURLFile is checked (default 5s)
+	CloudURLFileInterval caddy.Duration `json:"cloud_url_file_interval,omitempty"`
+
+	// HealthCheck, if set, probes the cloud URL in the background and falls
+	// back while the cloud is unreachable
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
+	// Rules are additional from/to replacements applied in order after the
+	// cloud URL rewrite (e.g. docs site, relay and OAuth hosts)
+	Rules []RewriteRule `json:"rules,omitempty"`
+
+	// Match selects which responses are rewritten. Defaults to JavaScript,
+	// HTML, CSS, JSON and web manifests, falling back to the .js, .mjs and
+	// .map extensions when Content-Type is missing.
+	Match []ResponseMatcher `json:"match,omitempty"`
+
+	// Stream rewrites uncompressed responses as they are written instead of
+	// buffering the whole response; HTML is always buffered for the tokenizer
+	Stream bool `json:"stream,omitempty"`
+
+	// StreamWindow is how many bytes regexp rules hold back between writes
+	// when streaming (default 4KiB); longer regexp matches may be missed
+	StreamWindow int `json:"stream_window,omitempty"`
+
+	// Cache keeps rewritten bodies in memory, keyed by path, upstream ETag
+	// and rule set, so unchanged assets are rewritten once
+	Cache bool `json:"cache,omitempty"`
+
+	// CacheSize bounds the rewrite cache in bytes (default 64MiB)
+	CacheSize int `json:"cache_size,omitempty"`
+
+	// Compress lists encodings (br, gzip, zstd) rewritten responses are
+	// offered in, in order of preference; the client's Accept-Encoding
+	// picks the variant. Variants are only kept when Cache is set; without
+	// it every buffered response is compressed again.
+	Compress []string `json:"compress,omitempty"`
+
+	// Debug adds an X-VK-Rewrite header listing the rules applied to each
+	// response, and lets ?vk_rewrite=off (or the cookie it sets) switch
+	// rewriting off for a browser session
+	Debug bool `json:"debug,omitempty"`
+
+	// Expect is a canary that raises an alarm when responses the rules must
+	// change (such as the main bundle) come through without replacements
+	Expect *RewriteExpectation `json:"expect,omitempty"`
+
+	// InjectionScript is JavaScript injected before </body> in HTML responses
+	InjectionScript string `json:"injection_script,omitempty"`
+
+	// InjectionScriptPath is a file containing the script to inject
+	// (used if InjectionScript is empty; defaults to the embedded plugin system)
+	InjectionScriptPath string `json:"injection_script_path,omitempty"`
+
+	// DisableInjection turns off the plugin script injection; explicit
+	// Injections are still applied
+	DisableInjection bool `json:"disable_injection,omitempty"`
+
+	// Injections are extra snippets (scripts, styles, meta tags) inserted
+	// into HTML pages at head-start, head-end or body-end
+	Injections []Injection `json:"injections,omitempty"`
+
+	// PluginsDir is a directory of plugin .js files served under /__vk/plugins/
+	// and loaded into the page by the injected plugin system
+	PluginsDir string `json:"plugins_dir,omitempty"`
+
+	// Plugins lists the enabled plugin names in load order (default: every
+	// .js file in PluginsDir, by name)
+	Plugins []string `json:"plugins,omitempty"`
+
+	// Config, if set, injects window.__VK_CONFIG__ into HTML pages and serves
+	// it at /__vk/config.js and /__vk/config.json
+	Config *RuntimeConfig `json:"config,omitempty"`
+
 	// resolvedCloudURL is the final URL after env var resolution
 	resolvedCloudURL string
 
+	// standbyURLs are the cloud URLs after the first of CloudURLs
+	standbyURLs []string
+
+	// cloudURLFile is the watched cloud URL file, if any
+	cloudURLFile string
+
+	// cloudURLSource names where resolvedCloudURL came from, for errors
+	cloudURLSource string
+
+	// health is the cloud's latest health status when HealthCheck is set
+	health *healthState
+
+	// rules holds the effective ordered rule set, built at provision time
+	// and replaced when rules are changed at runtime
+	rules *ruleState
+
+	// matchers is the effective matcher list (configured or default)
+	matchers []ResponseMatcher
+
+	// cachedScript is the injection script loaded once at provision time
+	cachedScript string
+
+	// snippets are the injections (including the script) cached at provision time
+	snippets []htmlSnippet
+
+	// config is the runtime config merged from env and directive settings
+	config *RuntimeConfig
+
+	// cache holds rewritten bodies when Cache is enabled
+	cache *rewriteCache
+
+	// metrics are registered with Caddy's metrics registry at provision time
+	metrics *metrics
+
+	// events is Caddy's events app, if loaded
+	ctx    caddy.Context
+	events eventEmitter
+
 	logger *zap.Logger
 }
 
@@ -44,46 +174,541 @@ func (PluginInjector) CaddyModule() caddy.ModuleInfo {
 }
 
 // parseCaddyfile sets up the handler from Caddyfile tokens.
-// Syntax: vk_rewrite [<cloud_url>]
-// If cloud_url is not provided, reads from VK_CLOUD_URL env var.
 func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
 	var p PluginInjector
+	err := p.UnmarshalCaddyfile(h.Dispenser)
+	return &p, err
+}
 
-	// Optional: read cloud URL from directive argument
-	for h.Next() {
-		args := h.RemainingArgs()
-		if len(args) > 1 {
-			return nil, h.ArgErr()
-		}
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+// Syntax:
+//
+//	vk_rewrite [<cloud_urls...>] {
+//	    name <name>
+//	    cloud_url_file <path> [<interval>]
+//	    health_check [<path>] {
+//	        interval <duration>
+//	        timeout <duration>
+//	        fails <count>
+//	        passes <count>
+//	        fallback <passthrough|banner|cloud_url <url>>
+//	    }
+//	    rule <from> <to> {
+//	        path <globs...>
+//	    }
+//	    rule_regexp <pattern> <replacement> {
+//	        path <globs...>
+//	    }
+//	    match {
+//	        content_type <types...>
+//	        extension <extensions...>
+//	        path <globs...>
+//	        identity_upstream
+//	    }
+//	    stream [<window_size>]
+//	    cache [<size>]
+//	    compress [<encodings...>]
+//	    debug
+//	    expect_rewrites [<min>] {
+//	        path <globs...>
+//	        banner
+//	    }
+//	    inject_script <js>
+//	    inject_script_file <path>
+//	    disable_injection
+//	    inject <head-start|head-end|body-end> <html>
+//	    inject_file <head-start|head-end|body-end> <path>
+//	    plugins_dir <path>
+//	    plugins <name...>
+//	    config {
+//	        instance_name <name>
+//	        feature <name> [on|off]
+//	    }
+//	}
+//
+// Several cloud URLs are candidates in order of preference, failed over by
+// the health check. If none is provided, reads from cloud_url_file, or the
+// file named by VK_CLOUD_URL_FILE, or the VK_CLOUD_URL env var.
+// Replacements may contain Caddy placeholders, expanded per request.
+func (p *PluginInjector) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		// Optional: read cloud URLs from directive arguments
+		args := d.RemainingArgs()
 		if len(args) == 1 {
 			p.CloudURL = args[0]
+		} else if len(args) > 1 {
+			p.CloudURLs = args
+		}
+
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "name":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				p.Name = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "cloud_url_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				p.CloudURLFile = d.Val()
+				if d.NextArg() {
+					interval, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.Errf("parsing cloud URL file interval: %v", err)
+					}
+					p.CloudURLFileInterval = caddy.Duration(interval)
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "health_check":
+				p.HealthCheck = &HealthCheck{}
+				if d.NextArg() {
+					p.HealthCheck.Path = d.Val()
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					switch d.Val() {
+					case "interval", "timeout":
+						name := d.Val()
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(d.Val())
+						if err != nil {
+							return d.Errf("parsing health check %s: %v", name, err)
+						}
+						if name == "interval" {
+							p.HealthCheck.Interval = caddy.Duration(dur)
+						} else {
+							p.HealthCheck.Timeout = caddy.Duration(dur)
+						}
+						if d.NextArg() {
+							return d.ArgErr()
+						}
+					case "fails", "passes":
+						name := d.Val()
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						count, err := strconv.Atoi(d.Val())
+						if err != nil {
+							return d.Errf("parsing health check %s: %v", name, err)
+						}
+						if name == "fails" {
+							p.HealthCheck.Fails = count
+						} else {
+							p.HealthCheck.Passes = count
+						}
+						if d.NextArg() {
+							return d.ArgErr()
+						}
+					case "fallback":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						p.HealthCheck.Fallback = d.Val()
+						if p.HealthCheck.Fallback == fallbackCloudURL {
+							if !d.NextArg() {
+								return d.ArgErr()
+							}
+							p.HealthCheck.FallbackURL = d.Val()
+						}
+						if d.NextArg() {
+							return d.ArgErr()
+						}
+					default:
+						return d.Errf("unrecognized health_check subdirective '%s'", d.Val())
+					}
+				}
+			case "rule", "rule_regexp":
+				rule := RewriteRule{Regexp: d.Val() == "rule_regexp"}
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				rule.From, rule.To = args[0], args[1]
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					switch d.Val() {
+					case "path":
+						paths := d.RemainingArgs()
+						if len(paths) == 0 {
+							return d.ArgErr()
+						}
+						rule.Paths = append(rule.Paths, paths...)
+					default:
+						return d.Errf("unrecognized rule subdirective '%s'", d.Val())
+					}
+				}
+				p.Rules = append(p.Rules, rule)
+			case "match":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				var m ResponseMatcher
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					directive := d.Val()
+					values := d.RemainingArgs()
+					if directive == "identity_upstream" {
+						if len(values) > 0 {
+							return d.ArgErr()
+						}
+						m.IdentityUpstream = true
+						continue
+					}
+					if len(values) == 0 {
+						return d.ArgErr()
+					}
+					switch directive {
+					case "content_type":
+						m.ContentTypes = append(m.ContentTypes, values...)
+					case "extension":
+						m.Extensions = append(m.Extensions, values...)
+					case "path":
+						m.Paths = append(m.Paths, values...)
+					default:
+						return d.Errf("unrecognized match subdirective '%s'", directive)
+					}
+				}
+				p.Match = append(p.Match, m)
+			case "stream":
+				p.Stream = true
+				if d.NextArg() {
+					size, err := humanize.ParseBytes(d.Val())
+					if err != nil {
+						return d.Errf("parsing stream window size: %v", err)
+					}
+					p.StreamWindow = int(size)
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "cache":
+				p.Cache = true
+				if d.NextArg() {
+					size, err := humanize.ParseBytes(d.Val())
+					if err != nil {
+						return d.Errf("parsing cache size: %v", err)
+					}
+					p.CacheSize = int(size)
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "compress":
+				p.Compress = d.RemainingArgs()
+				if len(p.Compress) == 0 {
+					p.Compress = append([]string(nil), defaultCompress...)
+				}
+			case "debug":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				p.Debug = true
+			case "expect_rewrites":
+				p.Expect = &RewriteExpectation{}
+				if d.NextArg() {
+					min, err := strconv.Atoi(d.Val())
+					if err != nil {
+						return d.Errf("parsing expected replacements: %v", err)
+					}
+					p.Expect.Min = min
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					switch d.Val() {
+					case "path":
+						paths := d.RemainingArgs()
+						if len(paths) == 0 {
+							return d.ArgErr()
+						}
+						p.Expect.Paths = append(p.Expect.Paths, paths...)
+					case "banner":
+						if d.NextArg() {
+							return d.ArgErr()
+						}
+						p.Expect.Banner = true
+					default:
+						return d.Errf("unrecognized expect_rewrites subdirective '%s'", d.Val())
+					}
+				}
+			case "inject_script":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				p.InjectionScript = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "inject_script_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				p.InjectionScriptPath = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "inject", "inject_file":
+				directive := d.Val()
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				inj := Injection{At: args[0]}
+				if directive == "inject" {
+					inj.HTML = args[1]
+				} else {
+					inj.File = args[1]
+				}
+				p.Injections = append(p.Injections, inj)
+			case "plugins_dir":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				p.PluginsDir = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+			case "plugins":
+				names := d.RemainingArgs()
+				if len(names) == 0 {
+					return d.ArgErr()
+				}
+				p.Plugins = append(p.Plugins, names...)
+			case "config":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				if p.Config == nil {
+					p.Config = &RuntimeConfig{}
+				}
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					switch d.Val() {
+					case "instance_name":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						p.Config.InstanceName = d.Val()
+						if d.NextArg() {
+							return d.ArgErr()
+						}
+					case "feature":
+						args := d.RemainingArgs()
+						if len(args) < 1 || len(args) > 2 {
+							return d.ArgErr()
+						}
+						enabled := true
+						if len(args) == 2 {
+							switch args[1] {
+							case "on":
+							case "off":
+								enabled = false
+							default:
+								return d.Errf("feature state must be 'on' or 'off', got '%s'", args[1])
+							}
+						}
+						if p.Config.Features == nil {
+							p.Config.Features = make(map[string]bool)
+						}
+						p.Config.Features[args[0]] = enabled
+					default:
+						return d.Errf("unrecognized config subdirective '%s'", d.Val())
+					}
+				}
+			case "disable_injection":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				p.DisableInjection = true
+			default:
+				return d.Errf("unrecognized subdirective '%s'", d.Val())
+			}
 		}
 	}
 
-	return &p, nil
+	return nil
 }
 
 // Provision implements caddy.Provisioner.
 func (p *PluginInjector) Provision(ctx caddy.Context) error {
 	p.logger = ctx.Logger(p)
 
-	// Resolve cloud URL: explicit config > VK_CLOUD_URL env > no-op mode
-	if p.CloudURL != "" {
-		p.resolvedCloudURL = p.CloudURL
+	if p.Name != "" && !pluginNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid name %q", p.Name)
+	}
+
+	// Resolve cloud URL: explicit config > cloud URL file > VK_CLOUD_URL env > no-op mode
+	configured := 0
+	for _, set := range []bool{p.CloudURL != "", len(p.CloudURLs) > 0, p.CloudURLFile != ""} {
+		if set {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return fmt.Errorf("cloud_url, cloud_urls and cloud_url_file are mutually exclusive")
+	}
+	p.cloudURLFile = p.CloudURLFile
+	if configured == 0 {
+		p.cloudURLFile = os.Getenv("VK_CLOUD_URL_FILE")
+	}
+	p.standbyURLs = nil
+	if len(p.CloudURLs) > 0 {
+		p.resolvedCloudURL = normalizeCloudURL(p.CloudURLs[0])
+		for _, cloudURL := range p.CloudURLs[1:] {
+			p.standbyURLs = append(p.standbyURLs, normalizeCloudURL(cloudURL))
+		}
+		p.cloudURLSource = "cloud_urls"
+		p.logger.Info("using configured cloud URLs",
+			zap.String("url", p.resolvedCloudURL),
+			zap.Strings("standbys", p.standbyURLs))
+	} else if p.CloudURL != "" {
+		p.resolvedCloudURL = normalizeCloudURL(p.CloudURL)
+		p.cloudURLSource = "cloud_url"
 		p.logger.Info("using configured cloud URL",
 			zap.String("url", p.resolvedCloudURL))
+	} else if p.cloudURLFile != "" {
+		cloudURL, err := readCloudURL(p.cloudURLFile)
+		if err != nil {
+			return fmt.Errorf("reading cloud URL file: %v", err)
+		}
+		if err := checkCloudURL(cloudURL); err != nil {
+			return fmt.Errorf("cloud URL file %s: %v", p.cloudURLFile, err)
+		}
+		p.resolvedCloudURL = cloudURL
+		p.cloudURLSource = "cloud URL file " + p.cloudURLFile
+		p.logger.Info("using cloud URL from file",
+			zap.String("file", p.cloudURLFile),
+			zap.String("url", p.resolvedCloudURL))
 	} else if envURL := os.Getenv("VK_CLOUD_URL"); envURL != "" {
-		p.resolvedCloudURL = envURL
+		p.resolvedCloudURL = normalizeCloudURL(envURL)
+		p.cloudURLSource = "VK_CLOUD_URL"
 		p.logger.Info("using cloud URL from VK_CLOUD_URL env var",
 			zap.String("url", p.resolvedCloudURL))
 	} else {
 		// No cloud URL configured - enable no-op mode (pass-through)
-		p.logger.Info("VK_CLOUD_URL not set, URL rewriting disabled (pass-through mode)")
+		p.logger.Info("VK_CLOUD_URL not set, cloud URL rewriting disabled")
+	}
+
+	p.health = nil
+	if p.HealthCheck != nil {
+		if err := p.HealthCheck.provision(); err != nil {
+			return fmt.Errorf("health_check: %v", err)
+		}
+		p.health = &healthState{}
 	}
 
+	// Build the effective rule set: cloud URL rewrite first, then configured rules
+	set, err := buildRuleSet(ctx, p.resolvedCloudURL, p.Rules)
+	if err != nil {
+		return err
+	}
+	if err := p.attachAlternates(ctx, set, p.standbyURLs, p.Rules); err != nil {
+		return fmt.Errorf("health_check: %v", err)
+	}
+	p.rules = newRuleState(set)
+	if len(set.rules) == 0 {
+		p.logger.Info("no rewrite rules configured (pass-through mode)")
+	}
+
+	// Select which responses are rewritten
+	p.matchers = p.Match
+	if len(p.matchers) == 0 {
+		p.matchers = []ResponseMatcher{{
+			ContentTypes: append([]string(nil), defaultContentTypes...),
+			Extensions:   append([]string(nil), defaultExtensions...),
+		}}
+	}
+	for i := range p.matchers {
+		if err := p.matchers[i].provision(ctx); err != nil {
+			return fmt.Errorf("match %d: %v", i, err)
+		}
+	}
+
+	p.cache = nil
+	if p.Cache {
+		size := p.CacheSize
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		p.cache = newRewriteCache(size)
+	}
+
+	if err := p.provisionCompress(); err != nil {
+		return err
+	}
+	if p.Expect != nil {
+		if err := p.Expect.provision(ctx); err != nil {
+			return fmt.Errorf("expect: %v", err)
+		}
+	}
+	if err := p.provisionMetrics(ctx.GetMetricsRegistry()); err != nil {
+		return fmt.Errorf("registering metrics: %v", err)
+	}
+	if err := p.provisionEvents(ctx); err != nil {
+		return err
+	}
+	if err := p.provisionPlugins(); err != nil {
+		return err
+	}
+	if err := p.provisionConfig(); err != nil {
+		return err
+	}
+
+	// Load the injection script and snippets once so requests never touch the filesystem
+	if err := p.loadInjectionScript(); err != nil {
+		return err
+	}
+	if err := p.loadInjections(); err != nil {
+		return err
+	}
+
+	// Register with the admin API, picking up any runtime override
+	handlers.add(p)
+
+	// Watch the cloud URL file until the config is unloaded
+	if p.cloudURLFile != "" {
+		go p.watchCloudURLFile(ctx, p.resolvedCloudURL)
+	}
+
+	// Probe the cloud until the config is unloaded
+	if p.health != nil {
+		go p.checkHealth(ctx)
+	}
+
+	return nil
+}
+
+// Cleanup implements caddy.CleanerUpper.
+func (p *PluginInjector) Cleanup() error {
+	handlers.remove(p)
 	return nil
 }
 
+// responseMode is how a recorded response body is handled once its status
+// and headers are known.
+type responseMode int
+
+const (
+	// modeBuffer holds the whole body for processResponse
+	modeBuffer responseMode = iota
+	// modeStream rewrites the body as it is written to the client
+	modeStream
+	// modePassthrough writes the response straight to the client untouched
+	modePassthrough
+	// modeDiscard drops the body after the response was answered another way
+	modeDiscard
+	// modeCached drops the body and serves the cached transformed one
+	modeCached
+)
+
 // responseRecorder buffers the upstream response for processing.
 type responseRecorder struct {
 	http.ResponseWriter // embed the original ResponseWriter for interface delegation
@@ -91,12 +716,45 @@ type responseRecorder struct {
 	headers             http.Header
 	body                *bytes.Buffer
 	wroteHeader         bool
+
+	// handler and req, if set, let the recorder choose a mode at WriteHeader time
+	handler     *PluginInjector
+	req         *http.Request
+	mode        responseMode
+	stream      io.WriteCloser
+	bodyAllowed bool
+
+	// cond, if set, derives validators and answers conditional requests
+	cond *conditional
+
+	// ranged is set when the client's Range was withheld from upstream, so
+	// the slice must be cut from the transformed body
+	ranged bool
+
+	// client is the request as the client sent it, Range included; slice is
+	// the part of an untransformed body passed through to it
+	client *http.Request
+	slice  *byteRange
+
+	// cacheKey identifies the transformed body in the rewrite cache; cached
+	// holds it on a hit
+	cacheKey string
+	cached   rendered
+
+	// variant is the encoding a transformed body is sent in, or "" to keep
+	// the upstream coding
+	variant string
+
+	// acceptEncoding is the client's Accept-Encoding; identity is set when
+	// upstream was asked for an uncompressed response instead
+	acceptEncoding string
+	identity       bool
 }
 
 // newResponseRecorder creates a new response recorder.
 func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
 	return &responseRecorder{
-		ResponseWriter: w, // store original for Hijacker/Flusher support
+		ResponseWriter: w,   // store original for Hijacker/Flusher support
 		statusCode:     200, // default status
 		headers:        make(http.Header),
 		body:           new(bytes.Buffer),
@@ -105,6 +763,10 @@ func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
 
 // Header implements http.ResponseWriter.
 func (r *responseRecorder) Header() http.Header {
+	if r.mode != modeBuffer {
+		// Headers already went out; let late changes (e.g. trailers) reach the client
+		return r.ResponseWriter.Header()
+	}
 	return r.headers
 }
 
@@ -113,15 +775,125 @@ func (r *responseRecorder) Write(b []byte) (int, error) {
 	if !r.wroteHeader {
 		r.WriteHeader(http.StatusOK)
 	}
+	switch r.mode {
+	case modeStream:
+		return r.stream.Write(b)
+	case modePassthrough:
+		if !r.bodyAllowed {
+			// Per RFC 7231 and RFC 7232, certain responses MUST NOT have a body
+			return len(b), nil
+		}
+		if r.slice != nil {
+			return r.writeSlice(b)
+		}
+		return r.ResponseWriter.Write(b)
+	case modeDiscard, modeCached:
+		return len(b), nil
+	}
 	return r.body.Write(b)
 }
 
 // WriteHeader implements http.ResponseWriter.
 func (r *responseRecorder) WriteHeader(statusCode int) {
-	if !r.wroteHeader {
-		r.statusCode = statusCode
-		r.wroteHeader = true
+	if r.wroteHeader {
+		return
+	}
+	r.statusCode = statusCode
+	r.wroteHeader = true
+
+	if r.handler == nil {
+		return
+	}
+	r.mode = r.handler.chooseMode(r.req, statusCode, r.headers)
+	if r.ranged && statusCode == http.StatusOK && r.mode == modeStream {
+		// Upstream never saw the client's Range; slices are cut from the
+		// whole transformed body
+		r.mode = modeBuffer
+	}
+	key, cacheable := "", false
+	if r.mode != modePassthrough {
+		r.variant = r.handler.variantFor(r.acceptEncoding, r.identity)
+		if r.variant != "" {
+			addVary(r.headers, "Accept-Encoding")
+		}
+		// Keyed on the upstream ETag, before it is replaced by a derived one
+		key, cacheable = r.handler.cacheKey(r.req, r.cond, statusCode, r.headers, r.variant)
+	}
+	if r.cond != nil {
+		// Transformed bodies get their own validators; if the client already
+		// has this one, answer 304 and drop the upstream body
+		switch {
+		case r.mode == modePassthrough:
+			r.cond.reviveNotModified(statusCode, r.headers)
+		case r.cond.derive(r.headers, r.variant) && r.cond.notModified(r.req, statusCode, r.headers):
+			r.mode = modeDiscard
+			writeNotModified(r.ResponseWriter, r.headers)
+			return
+		}
+	}
+	if r.ranged && statusCode == http.StatusOK && r.mode == modePassthrough {
+		// Cut the slice from the untransformed body as it streams through,
+		// falling back to buffering the whole body when that isn't possible
+		switch slice, ok := passthroughRange(r.client, r.headers); {
+		case !ok:
+			r.mode = modeBuffer
+		case slice != nil:
+			r.slice = slice
+			r.headers.Set("Content-Range", slice.contentRange())
+			r.headers.Set("Content-Length", strconv.FormatInt(slice.length, 10))
+			statusCode = http.StatusPartialContent
+			r.statusCode = statusCode
+		}
+	}
+	if cacheable {
+		if body, ok := r.handler.cache.get(key); ok {
+			r.mode, r.cached = modeCached, body
+			return
+		}
+		if r.mode == modeBuffer {
+			r.cacheKey = key
+		}
 	}
+	if r.mode == modeBuffer {
+		return
+	}
+
+	// Streaming and passthrough send headers now and the body as it arrives
+	if r.handler.Debug {
+		if r.mode == modeStream {
+			// Counts are only known once the body is through
+			r.headers.Add("Trailer", debugHeader)
+		} else {
+			r.headers.Set(debugHeader, "none")
+		}
+	}
+	header := r.ResponseWriter.Header()
+	for key, values := range r.headers {
+		switch key {
+		case "Set-Cookie", "Vary":
+			// Keep cookies and Vary fields this module already set on the
+			// client response, such as the cloud pin and kill switch
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		default:
+			header[key] = values
+		}
+	}
+	if r.mode == modeStream {
+		// The rewritten length isn't known up front, so drop Content-Length
+		header.Del("Content-Length")
+		var encoded bool
+		r.stream, encoded = r.handler.newEncodedStream(r.req, r.headers, r.ResponseWriter, r.variant)
+		if encoded {
+			header.Set("Content-Encoding", variantEncoding(r.variant))
+		} else if variantEncoding(r.variant) != "" {
+			// The derived ETag names a variant we couldn't produce
+			header.Del("ETag")
+		}
+	}
+	r.bodyAllowed = r.handler.shouldWriteResponseBody(r.req.Method, statusCode)
+	r.ResponseWriter.WriteHeader(statusCode)
 }
 
 // Hijack implements http.Hijacker interface.
@@ -135,8 +907,18 @@ func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 }
 
 // Flush implements http.Flusher interface.
-// This is required for streaming responses and chunked encoding.
+// This is required for streaming responses and chunked encoding. Only
+// streamed and passed-through responses are flushed; buffered ones have
+// their headers and body written once ServeHTTP is done with them.
 func (r *responseRecorder) Flush() {
+	switch r.mode {
+	case modeStream:
+		// Push out what the rewriter and encoder hold before the connection
+		flushWriter(r.stream)
+	case modePassthrough:
+	default:
+		return
+	}
 	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
 	}
@@ -155,6 +937,26 @@ func isUpgradeRequest(r *http.Request) bool {
 
 // ServeHTTP implements caddyhttp.MiddlewareHandler.
 func (p *PluginInjector) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	// The plugin directory and runtime config are served by the module
+	// itself, never proxied
+	if p.servesPlugins(r) {
+		return p.servePlugins(w, r)
+	}
+	if p.servesConfig(r) {
+		return p.serveConfig(w, r)
+	}
+
+	r = p.pinCloud(w, r)
+	p.startPlaceholders(r)
+	p.warnMixedContent(r)
+
+	// In debug mode a browser session can switch the handler off to compare
+	// with upstream behaviour
+	r, bypass := p.rewriteDisabled(w, r)
+	if bypass {
+		return next.ServeHTTP(newBypassWriter(w), r)
+	}
+
 	// Check if this is a protocol upgrade request (WebSocket, HTTP/2, etc.)
 	// These requests require direct connection hijacking and cannot be buffered
 	if isUpgradeRequest(r) {
@@ -164,20 +966,77 @@ func (p *PluginInjector) ServeHTTP(w http.ResponseWriter, r *http.Request, next
 				zap.String("connection", r.Header.Get("Connection")))
 		}
 		// Pass through directly without buffering
+		p.metrics.upgradeBypassed()
 		return next.ServeHTTP(w, r)
 	}
 
-	// Create a response recorder to buffer the upstream response
+	// Create a response recorder; it decides at WriteHeader time whether the
+	// upstream response is buffered, streamed, or passed straight through
 	rec := newResponseRecorder(w)
+	stats := &rewriteStats{}
+	r = withStats(r, stats)
+	client := r
+	r, rec.cond = p.prepareConditional(r)
+	r, rec.ranged = p.withholdRange(r)
+	rec.client = client
+	rec.acceptEncoding = r.Header.Get("Accept-Encoding")
+	r, rec.identity = p.withIdentityUpstream(r)
+	rec.handler, rec.req = p, r
 
 	// Call the next handler with our recorder
 	err := next.ServeHTTP(rec, r)
+	switch rec.mode {
+	case modePassthrough, modeDiscard:
+		return err
+	case modeStream:
+		// Headers and most of the body are already out; flush the carry-over
+		if closeErr := rec.stream.Close(); err == nil {
+			err = closeErr
+		}
+		finishPlaceholders(r, modeStreamLabel, *stats, 0)
+		if p.Debug {
+			w.Header().Set(debugHeader, stats.debugValue())
+		}
+		return err
+	}
 	if err != nil {
 		return err
 	}
 
-	// Process the buffered response (inject if HTML)
-	processedBody := p.processResponse(rec.headers, rec.body.Bytes())
+	// Process the buffered response (inject if HTML), or reuse the cached result
+	var out rendered
+	ok := true
+	switch {
+	case rec.mode == modeCached:
+		out = rec.cached
+		if p.logger != nil {
+			p.logger.Debug("serving rewritten response from cache", zap.String("path", r.URL.Path))
+		}
+	case rec.cacheKey != "":
+		p.metrics.bufferedResponse(rec.body.Len())
+		out, ok = p.renderCached(r, rec.cacheKey, rec.headers, rec.body.Bytes(), rec.variant)
+	default:
+		p.metrics.bufferedResponse(rec.body.Len())
+		out, ok = p.render(r, rec.headers, rec.body.Bytes(), rec.variant)
+	}
+	if rec.mode == modeCached {
+		finishPlaceholders(r, modeCachedLabel, out.stats, 0)
+	} else {
+		finishPlaceholders(r, modeBufferLabel, out.stats, rec.body.Len())
+	}
+	if p.Debug {
+		rec.headers.Set(debugHeader, out.stats.debugValue())
+	}
+	processedBody := out.body
+	if out.encoding == "" {
+		rec.headers.Del("Content-Encoding")
+	} else {
+		rec.headers.Set("Content-Encoding", out.encoding)
+	}
+	if !ok {
+		// The derived ETag names a variant we couldn't produce
+		rec.headers.Del("ETag")
+	}
 
 	// Copy headers from recorder to actual response writer
 	for key, values := range rec.headers {
@@ -186,8 +1045,23 @@ func (p *PluginInjector) ServeHTTP(w http.ResponseWriter, r *http.Request, next
 		}
 	}
 
-	// Update Content-Length header with new body size
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(processedBody)))
+	// Serve the requested slice of the transformed body; ServeContent sets
+	// Content-Range and Content-Length and honours If-Range
+	if rec.ranged && rec.statusCode == http.StatusOK {
+		w.Header().Del("Content-Length")
+		http.ServeContent(w, client, "", time.Time{}, bytes.NewReader(processedBody))
+		return nil
+	}
+
+	// Update Content-Length header with new body size. When upstream sent no
+	// body for a HEAD there is nothing to measure (a compressed variant of
+	// the empty body isn't the length a GET gets), and upstream's length is
+	// that of the untransformed body, so neither is sent
+	if r.Method == http.MethodHead && rec.body.Len() == 0 {
+		w.Header().Del("Content-Length")
+	} else {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(processedBody)))
+	}
 
 	// Write status code
 	w.WriteHeader(rec.statusCode)
@@ -203,6 +1077,18 @@ func (p *PluginInjector) ServeHTTP(w http.ResponseWriter, r *http.Request, next
 	return nil
 }
 
+// withholdRange strips Range and If-Range from requests that may be
+// transformed, so upstream sends the whole resource to rewrite.
+func (p *PluginInjector) withholdRange(r *http.Request) (*http.Request, bool) {
+	if r.Header.Get("Range") == "" || !p.mayTransformPath(r) {
+		return r, false
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del("Range")
+	r.Header.Del("If-Range")
+	return r, true
+}
+
 // shouldWriteResponseBody determines if a response body should be written
 // based on HTTP method and status code semantics.
 func (p *PluginInjector) shouldWriteResponseBody(method string, statusCode int) bool {
@@ -230,63 +1116,193 @@ func (p *PluginInjector) shouldWriteResponseBody(method string, statusCode int)
 	return true
 }
 
-// processResponse checks if the response is JavaScript and rewrites API URLs if needed.
-func (p *PluginInjector) processResponse(headers http.Header, body []byte) []byte {
-	// Skip rewrite if response is compressed (would corrupt the output)
-	contentEncoding := headers.Get("Content-Encoding")
-	if contentEncoding != "" {
+// chooseMode decides, once the status and headers are known, whether a
+// response is buffered, streamed through the rewriter, or passed straight
+// through. Only responses a rule may transform are ever held in memory.
+func (p *PluginInjector) chooseMode(r *http.Request, statusCode int, headers http.Header) responseMode {
+	if !p.mayTransform(r, statusCode, headers) {
+		return modePassthrough
+	}
+	if p.shouldStream(r, statusCode, headers) {
+		return modeStream
+	}
+	return modeBuffer
+}
+
+// mayTransform reports whether any rule could change a response with these
+// headers, i.e. whether it is worth holding on to its body.
+func (p *PluginInjector) mayTransform(r *http.Request, statusCode int, headers http.Header) bool {
+	// 1xx, 204 and 304 responses carry no body to rewrite
+	if (statusCode >= 100 && statusCode < 200) || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return false
+	}
+	// A 206 is a slice of the resource; rewriting it would corrupt Content-Range
+	if statusCode == http.StatusPartialContent {
+		return false
+	}
+	if enc := contentCoding(headers); enc != "" && !isSupportedEncoding(enc) {
+		// Only report responses that would otherwise have been transformed
+		if (len(p.rulesFor(r)) > 0 && p.matchesResponse(r, headers)) || p.shouldInject(headers) {
+			p.skippedEncoded(r, enc)
+		}
+		return false
+	}
+	if p.shouldInject(headers) {
+		return true
+	}
+	if len(p.rulesFor(r)) == 0 {
+		return false
+	}
+	if !p.matchesResponse(r, headers) {
+		p.metrics.skippedResponse(skipContentType)
+		return false
+	}
+	return true
+}
+
+// shouldStream reports whether a response can be rewritten as it is written
+// rather than buffered. Only uncompressed matched non-HTML responses with a
+// body qualify.
+func (p *PluginInjector) shouldStream(r *http.Request, statusCode int, headers http.Header) bool {
+	if !p.Stream || len(p.rulesFor(r)) == 0 {
+		return false
+	}
+	if statusCode != http.StatusOK || !p.shouldWriteResponseBody(r.Method, statusCode) {
+		return false
+	}
+	if contentCoding(headers) != "" {
+		// Compressed bodies go through the buffered decode/re-encode path
+		return false
+	}
+	if isHTML(headers) {
+		// HTML goes through the tokenizer, which needs the whole document to
+		// skip comments and <template> contents and place snippets
+		return false
+	}
+	return p.matchesResponse(r, headers)
+}
+
+// processResponse rewrites API URLs in matched responses and injects the
+// plugin script into HTML pages.
+func (p *PluginInjector) processResponse(r *http.Request, headers http.Header, body []byte) []byte {
+	rewrite := p.matchesResponse(r, headers) && len(p.rulesFor(r)) > 0
+	inject := p.shouldInject(headers)
+	if !rewrite && !inject {
 		return body
 	}
 
-	// Check Content-Type header (case-insensitive)
-	contentType := headers.Get("Content-Type")
+	// Compressed responses are decoded, transformed, and re-encoded with the
+	// same coding; anything we can't round-trip is passed through untouched
+	contentEncoding := contentCoding(headers)
+	if contentEncoding == "" {
+		transformed, _ := p.transformBody(r, headers, body, rewrite, inject)
+		return transformed
+	}
+	if !isSupportedEncoding(contentEncoding) {
+		p.skippedEncoded(r, contentEncoding)
+		if p.logger != nil {
+			p.logger.Debug("skipping rewrite for unsupported content encoding",
+				zap.String("encoding", contentEncoding))
+		}
+		return body
+	}
 
-	// Only process JavaScript responses
-	// Common content types: application/javascript, text/javascript, application/x-javascript
-	contentTypeLower := strings.ToLower(contentType)
-	if !strings.Contains(contentTypeLower, "javascript") {
+	decoded, err := decodeBody(contentEncoding, body)
+	if err != nil {
+		p.metrics.skippedResponse(skipEncoding)
+		p.rewriteFailed(r, stageDecode, err)
+		if p.logger != nil {
+			p.logger.Warn("failed to decode response, passing through unchanged",
+				zap.String("encoding", contentEncoding),
+				zap.Error(err))
+		}
 		return body
 	}
 
-	// Rewrite API URLs in JavaScript
-	return p.rewriteJavaScript(body)
-}
+	transformed, changed := p.transformBody(r, headers, decoded, rewrite, inject)
+	if !changed {
+		// Nothing changed, keep the upstream bytes as-is
+		return body
+	}
 
-// rewriteJavaScript replaces the official VK cloud API URL with the custom one.
-func (p *PluginInjector) rewriteJavaScript(js []byte) []byte {
-	// No-op mode: if no cloud URL is configured, pass through without rewriting
-	if p.resolvedCloudURL == "" {
-		return js
+	encoded, err := encodeBody(contentEncoding, transformed)
+	if err != nil {
+		p.rewriteFailed(r, stageEncode, err)
+		if p.logger != nil {
+			p.logger.Error("failed to re-encode rewritten response, passing through unchanged",
+				zap.String("encoding", contentEncoding),
+				zap.Error(err))
+		}
+		return body
 	}
 
-	// The official VK cloud API URL that appears in the npm package bundle
-	officialURL := []byte("https://api.vibekanban.com")
-	customURL := []byte(p.resolvedCloudURL)
+	return encoded
+}
+
+// transformBody applies URL rewriting and/or HTML injection to a decoded
+// body, reporting whether anything changed.
+func (p *PluginInjector) transformBody(r *http.Request, headers http.Header, body []byte, rewrite, inject bool) ([]byte, bool) {
+	start := time.Now()
+	defer func() { p.metrics.observeRewrite(modeBufferLabel, time.Since(start)) }()
 
-	// Count occurrences for logging
-	count := bytes.Count(js, officialURL)
-	if count == 0 {
-		// No rewrites needed
-		return js
+	if !isHTML(headers) {
+		count := 0
+		if rewrite {
+			body, count = p.rewriteBody(r, body)
+			if !p.checkExpectation(r, count) {
+				if banner, _ := p.bannerFor(headers); banner != "" {
+					return append(body[:len(body):len(body)], banner...), true
+				}
+			}
+		}
+		return body, count > 0
 	}
 
-	// Replace all occurrences
-	rewritten := bytes.ReplaceAll(js, officialURL, customURL)
+	// HTML goes through the tokenizer so comments and <template> contents
+	// are left alone and injection points are found reliably
+	var rules []*activeRule
+	if rewrite {
+		rules = p.activeRules(r)
+	}
+	var snippets []htmlSnippet
+	if inject {
+		snippets = p.activeSnippets()
+		if p.config != nil {
+			cfg, err := p.configSnippet(r)
+			if err != nil {
+				p.rewriteFailed(r, stageConfig, err)
+				if p.logger != nil {
+					p.logger.Error("rendering runtime config", zap.Error(err))
+				}
+			} else {
+				snippets = append([]htmlSnippet{cfg}, snippets...)
+			}
+		}
+	}
 
-	if p.logger != nil {
-		p.logger.Debug("rewrote VK cloud API URLs in JavaScript",
-			zap.Int("replacements", count),
-			zap.String("from", string(officialURL)),
-			zap.String("to", p.resolvedCloudURL))
+	out, count, injected := rewriteHTML(body, rules, snippets)
+	p.reportRewrites(r, modeBufferLabel, rules, injected)
+	if rewrite && !p.checkExpectation(r, count) {
+		if _, banner := p.bannerFor(headers); banner != nil {
+			var shown bool
+			out, _, shown = rewriteHTML(out, nil, []htmlSnippet{*banner})
+			injected = injected || shown
+		}
+	}
+	if inject && !injected && p.logger != nil {
+		p.logger.Debug("no injection point found in HTML, skipping injection")
 	}
 
-	return rewritten
+	return out, count > 0 || injected
 }
 
 // Interface guards - ensure we implement required interfaces
 var (
 	_ caddy.Provisioner           = (*PluginInjector)(nil)
+	_ caddy.Validator             = (*PluginInjector)(nil)
+	_ caddy.CleanerUpper          = (*PluginInjector)(nil)
 	_ caddyhttp.MiddlewareHandler = (*PluginInjector)(nil)
+	_ caddyfile.Unmarshaler       = (*PluginInjector)(nil)
 	_ http.ResponseWriter         = (*responseRecorder)(nil)
 	_ http.Hijacker               = (*responseRecorder)(nil)
 	_ http.Flusher                = (*responseRecorder)(nil)
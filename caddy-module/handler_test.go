@@ -1378,10 +1378,16 @@ func TestResponseRecorderFlusher(t *testing.T) {
 
 	rec := newResponseRecorder(mockWriter)
 
-	// ACT: Call Flush
+	// ACT: Flush while buffering, then once passing through
+	rec.Flush()
+	flushedWhileBuffering := mockWriter.flushed
+	rec.mode = modePassthrough
 	rec.Flush()
 
-	// ASSERT: Flush was called on underlying writer
+	// ASSERT: Only the passed-through response is flushed
+	if flushedWhileBuffering {
+		t.Error("Flush reached the underlying ResponseWriter while buffering")
+	}
 	if !mockWriter.flushed {
 		t.Error("Flush was not called on underlying ResponseWriter")
 	}
@@ -1403,6 +1409,206 @@ func TestResponseRecorderFlusherNotSupported(t *testing.T) {
 	t.Log("Flush handled gracefully on non-flushable ResponseWriter")
 }
 
+// Test 32: Non-transformable responses are passed straight through, not buffered
+func TestPassthroughForNonTransformableResponses(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contentType string
+	}{
+		{"image", "image/png"},
+		{"font", "font/woff2"},
+		{"wasm", "application/wasm"},
+		{"download", "application/octet-stream"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE: Upstream checks whether bytes reach the client before it returns
+			payload := []byte("https://api.vibekanban.com binary-ish payload")
+			rec := httptest.NewRecorder()
+			var seenBeforeReturn int
+
+			upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(payload)))
+				w.WriteHeader(200)
+				w.Write(payload)
+				seenBeforeReturn = rec.Body.Len()
+				return nil
+			})
+
+			injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/download", nil)
+
+			// ACT
+			err := injector.ServeHTTP(rec, req, upstream)
+
+			// ASSERT: No errors
+			if err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT: Body went straight to the client
+			if seenBeforeReturn != len(payload) {
+				t.Errorf("Expected %d bytes written before upstream returned, got %d", len(payload), seenBeforeReturn)
+			}
+
+			// ASSERT: Body and upstream Content-Length are untouched
+			if !bytes.Equal(rec.Body.Bytes(), payload) {
+				t.Errorf("Expected body to be unchanged, got %q", rec.Body.Bytes())
+			}
+			if got := rec.Header().Get("Content-Length"); got != fmt.Sprintf("%d", len(payload)) {
+				t.Errorf("Expected upstream Content-Length, got %s", got)
+			}
+		})
+	}
+}
+
+// Test 33: Transformable responses are still buffered and rewritten
+func TestBuffersTransformableResponses(t *testing.T) {
+	// ARRANGE
+	rec := httptest.NewRecorder()
+	var seenBeforeReturn int
+
+	upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.WriteHeader(200)
+		w.Write([]byte(`fetch("https://api.vibekanban.com")`))
+		seenBeforeReturn = rec.Body.Len()
+		return nil
+	})
+
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT: Nothing reached the client until processing finished
+	if seenBeforeReturn != 0 {
+		t.Errorf("Expected buffered response, but %d bytes were written early", seenBeforeReturn)
+	}
+	if got := rec.Body.String(); got != `fetch("https://vk.example.com")` {
+		t.Errorf("Unexpected body %q", got)
+	}
+}
+
+// Test 34: Passthrough drops bodies the status code does not allow
+func TestPassthroughDropsDisallowedBody(t *testing.T) {
+	// ARRANGE
+	upstream := mockNextHandler([]byte("should not appear"), 304, http.Header{
+		"Content-Type": []string{"image/png"},
+		"ETag":         []string{`"img1"`},
+	})
+
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/logo.png", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if rec.Code != 304 {
+		t.Errorf("Expected status 304, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %d bytes", rec.Body.Len())
+	}
+	if rec.Header().Get("ETag") != `"img1"` {
+		t.Errorf("Expected ETag to be preserved, got %q", rec.Header().Get("ETag"))
+	}
+}
+
+// Test 35: Upstream flushes don't send buffered or streamed responses early
+func TestUpstreamFlushKeepsHeaders(t *testing.T) {
+	original := []byte(`fetch("https://api.vibekanban.com/v1")`)
+	expected := `fetch("https://vk.example.com/v1")`
+	gzipped, err := encodeBody("gzip", original)
+	if err != nil {
+		t.Fatalf("Failed to gzip body: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		injector *PluginInjector
+		body     []byte
+		encoding string
+	}{
+		{"buffered gzip", &PluginInjector{CloudURL: "https://vk.example.com"}, gzipped, "gzip"},
+		{"streamed variant", &PluginInjector{CloudURL: "https://vk.example.com", Stream: true, Compress: []string{"gzip"}}, original, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			ctx := createTestContext(t)
+			if err := tc.injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				w.Header().Set("Content-Type", "application/javascript")
+				w.Header().Set("ETag", `"v1"`)
+				if tc.encoding != "" {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				w.WriteHeader(http.StatusOK)
+				if err := http.NewResponseController(w).Flush(); err != nil {
+					return err
+				}
+				_, err := w.Write(tc.body)
+				return err
+			})
+			req := httptest.NewRequest("GET", "/assets/index.js", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := tc.injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT: headers as they went out with the status line
+			header := rec.Result().Header
+			if got := header.Get("Content-Type"); got != "application/javascript" {
+				t.Errorf("Expected Content-Type to survive the flush, got %q", got)
+			}
+			if got := header.Get("Content-Encoding"); got != "gzip" {
+				t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+			}
+			if !isDerivedETag(header.Get("ETag")) {
+				t.Errorf("Expected derived ETag, got %q", header.Get("ETag"))
+			}
+			body, err := decodeBody("gzip", rec.Body.Bytes())
+			if err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			if string(body) != expected {
+				t.Errorf("Expected %q, got %q", expected, body)
+			}
+		})
+	}
+}
+
 // Mock implementations for testing
 
 // mockNetConn implements net.Conn for testing
@@ -0,0 +1,431 @@
+package vibekanbanplugins
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// offlineBanner is the notice injected into pages while every cloud is down
+// and the banner fallback is configured.
+//
+//go:embed assets/cloud-offline-banner.js
+var offlineBanner string
+
+// Behaviours while the health check finds every cloud unreachable.
+const (
+	// fallbackPassthrough stops rewriting the cloud URL, so the app talks
+	// to the official cloud
+	fallbackPassthrough = "passthrough"
+
+	// fallbackCloudURL rewrites to HealthCheck.FallbackURL instead
+	fallbackCloudURL = "cloud_url"
+
+	// fallbackBanner keeps rewriting and injects an offline notice into pages
+	fallbackBanner = "banner"
+)
+
+// Health check defaults, matching the VK cloud container's own HEALTHCHECK.
+const (
+	defaultHealthPath     = "/health"
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthFails    = 2
+	defaultHealthPasses   = 3
+)
+
+// Values of {http.vk.cloud_status}.
+const (
+	cloudStatusUp      = "up"
+	cloudStatusDown    = "down"
+	cloudStatusUnknown = "unknown"
+)
+
+// cloudCookie pins a browser session to the cloud it was first served, so
+// it isn't split across clouds when their health changes.
+const cloudCookie = "vk_cloud"
+
+// HealthCheck probes each cloud URL's health endpoint in the background.
+// Requests use the first cloud that is up, and fall back while all are down.
+type HealthCheck struct {
+	// Path is the health endpoint, relative to the cloud URL (default /health)
+	Path string `json:"path,omitempty"`
+
+	// Interval is the time between probes (default 30s)
+	Interval caddy.Duration `json:"interval,omitempty"`
+
+	// Timeout bounds each probe (default 5s)
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// Fails is how many consecutive failed probes mark a cloud down (default 2)
+	Fails int `json:"fails,omitempty"`
+
+	// Passes is how many consecutive successful probes mark a down cloud up
+	// again (default 3)
+	Passes int `json:"passes,omitempty"`
+
+	// Fallback is what to do while every cloud is down: passthrough
+	// (default), cloud_url or banner
+	Fallback string `json:"fallback,omitempty"`
+
+	// FallbackURL is the cloud URL rewritten to by the cloud_url fallback
+	FallbackURL string `json:"fallback_url,omitempty"`
+}
+
+// provision applies defaults and validates the fallback.
+func (hc *HealthCheck) provision() error {
+	if hc.Path == "" {
+		hc.Path = defaultHealthPath
+	}
+	if !strings.HasPrefix(hc.Path, "/") {
+		return fmt.Errorf("path %q must start with /", hc.Path)
+	}
+	if hc.Interval < 0 || hc.Timeout < 0 {
+		return fmt.Errorf("interval and timeout must not be negative")
+	}
+	if hc.Interval == 0 {
+		hc.Interval = caddy.Duration(defaultHealthInterval)
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = caddy.Duration(defaultHealthTimeout)
+	}
+	if hc.Fails < 0 || hc.Passes < 0 {
+		return fmt.Errorf("fails and passes must not be negative")
+	}
+	if hc.Fails == 0 {
+		hc.Fails = defaultHealthFails
+	}
+	if hc.Passes == 0 {
+		hc.Passes = defaultHealthPasses
+	}
+	switch hc.Fallback {
+	case "":
+		hc.Fallback = fallbackPassthrough
+	case fallbackPassthrough, fallbackBanner:
+	case fallbackCloudURL:
+		hc.FallbackURL = normalizeCloudURL(hc.FallbackURL)
+		if err := checkCloudURL(hc.FallbackURL); err != nil {
+			return fmt.Errorf("fallback: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown fallback %q (want passthrough, cloud_url or banner)", hc.Fallback)
+	}
+	if hc.FallbackURL != "" {
+		return fmt.Errorf("fallback_url requires the cloud_url fallback")
+	}
+	return nil
+}
+
+// healthStatus is a cloud's health as of the latest probe.
+type healthStatus struct {
+	URL     string    `json:"url"`
+	Healthy bool      `json:"healthy"`
+	Checked time.Time `json:"checked"`
+	Since   time.Time `json:"since"`
+	Error   string    `json:"error,omitempty"`
+
+	// cloudURL is the rule set's cloud URL the status is for
+	cloudURL string
+
+	// streak counts consecutive probes that disagreed with Healthy
+	streak int
+}
+
+// healthState holds every cloud's health, in order of preference. It is
+// replaced after each round of probes and nil until the first.
+type healthState struct {
+	clouds atomic.Pointer[[]healthStatus]
+}
+
+// cloudHealth returns the clouds' latest health, or nil.
+func (p *PluginInjector) cloudHealth() []healthStatus {
+	if p.health == nil {
+		return nil
+	}
+	if clouds := p.health.clouds.Load(); clouds != nil {
+		return *clouds
+	}
+	return nil
+}
+
+// cloudUp reports whether requests may use a cloud URL: true unless it was
+// probed and found down.
+func (p *PluginInjector) cloudUp(cloudURL string) bool {
+	for _, st := range p.cloudHealth() {
+		if st.cloudURL == cloudURL {
+			return st.Healthy
+		}
+	}
+	return true
+}
+
+// cloudsDown reports whether every cloud of the rule set is down.
+func (p *PluginInjector) cloudsDown(set *ruleSet) bool {
+	if p.health == nil || set.cloudURL == "" {
+		return false
+	}
+	for _, candidate := range set.candidates() {
+		if p.cloudUp(candidate.cloudURL) {
+			return false
+		}
+	}
+	return true
+}
+
+// cloudStatus is the value of {http.vk.cloud_status}.
+func (p *PluginInjector) cloudStatus() string {
+	switch {
+	case p.cloudHealth() == nil:
+		return cloudStatusUnknown
+	case p.cloudsDown(p.currentRules()):
+		return cloudStatusDown
+	default:
+		return cloudStatusUp
+	}
+}
+
+// candidates returns the rule set for each cloud URL, in order of preference.
+func (set *ruleSet) candidates() []*ruleSet {
+	return append([]*ruleSet{set}, set.standbys...)
+}
+
+// attachAlternates builds the rule sets requests use instead of set: one per
+// standby cloud URL, and the fallback for when every cloud is down.
+func (p *PluginInjector) attachAlternates(ctx caddy.Context, set *ruleSet, standbyURLs []string, rules []RewriteRule) error {
+	if p.HealthCheck == nil || set.cloudURL == "" {
+		return nil
+	}
+	for i, cloudURL := range standbyURLs {
+		standby, err := buildRuleSet(ctx, cloudURL, rules)
+		if err != nil {
+			return fmt.Errorf("standby %d: %v", i, err)
+		}
+		set.standbys = append(set.standbys, standby)
+	}
+	if p.HealthCheck.Fallback == fallbackBanner {
+		return nil
+	}
+	fallbackURL := ""
+	if p.HealthCheck.Fallback == fallbackCloudURL {
+		fallbackURL = p.HealthCheck.FallbackURL
+	}
+	fallback, err := buildRuleSet(ctx, fallbackURL, rules)
+	if err != nil {
+		return fmt.Errorf("fallback: %v", err)
+	}
+	set.fallback = fallback
+	return nil
+}
+
+// selectRules picks the rule set for a request: the cloud its session is
+// pinned to while that stays up, else the first cloud that is up, else the
+// fallback. It reports whether the pick is one of the clouds.
+func (p *PluginInjector) selectRules(r *http.Request, set *ruleSet) (*ruleSet, bool) {
+	if p.health == nil || set.cloudURL == "" {
+		return set, false
+	}
+	candidates := set.candidates()
+	if len(candidates) > 1 {
+		if cookie, err := r.Cookie(cloudCookie); err == nil {
+			for _, candidate := range candidates {
+				if candidate.cloudURL == cookie.Value && p.cloudUp(candidate.cloudURL) {
+					return candidate, true
+				}
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if p.cloudUp(candidate.cloudURL) {
+			return candidate, true
+		}
+	}
+	if set.fallback != nil {
+		return set.fallback, false
+	}
+	return set, false
+}
+
+// rulesCtxKey is the request context key of the rule set chosen for it.
+type rulesCtxKey struct{}
+
+// pinCloud chooses the rule set for the request once, so health changes
+// mid-request don't mix clouds in one response. With standby clouds the
+// browser session is pinned to the chosen one with a cookie.
+func (p *PluginInjector) pinCloud(w http.ResponseWriter, r *http.Request) *http.Request {
+	set := p.currentRules()
+	chosen, isCloud := p.selectRules(r, set)
+	if isCloud && len(set.standbys) > 0 {
+		if cookie, err := r.Cookie(cloudCookie); err != nil || cookie.Value != chosen.cloudURL {
+			http.SetCookie(w, &http.Cookie{
+				Name:     cloudCookie,
+				Value:    chosen.cloudURL,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), rulesCtxKey{}, chosen))
+}
+
+// servingRules returns the rule set a request uses.
+func (p *PluginInjector) servingRules(r *http.Request) *ruleSet {
+	if set, ok := r.Context().Value(rulesCtxKey{}).(*ruleSet); ok {
+		return set
+	}
+	set, _ := p.selectRules(r, p.currentRules())
+	return set
+}
+
+// activeSnippets returns the snippets to inject: the configured ones, plus
+// the offline banner while every cloud is down.
+func (p *PluginInjector) activeSnippets() []htmlSnippet {
+	if p.HealthCheck == nil || p.HealthCheck.Fallback != fallbackBanner || !p.cloudsDown(p.currentRules()) {
+		return p.snippets
+	}
+	banner := htmlSnippet{at: injectBodyEnd, html: "<script>\n" + offlineBanner + "</script>\n"}
+	return append(p.snippets[:len(p.snippets):len(p.snippets)], banner)
+}
+
+// probeTarget returns the health endpoint of a cloud URL.
+func (p *PluginInjector) probeTarget(cloudURL string) (string, error) {
+	cloudURL = caddy.NewReplacer().ReplaceKnown(cloudURL, "")
+	if strings.Contains(cloudURL, "{") {
+		return "", fmt.Errorf("cloud URL %q has request placeholders and can't be probed", cloudURL)
+	}
+	return cloudURL + p.HealthCheck.Path, nil
+}
+
+// probeResult is the outcome of probing one cloud.
+type probeResult struct {
+	cloudURL string
+	target   string
+	err      error
+}
+
+// checkHealth probes the clouds until ctx is done.
+func (p *PluginInjector) checkHealth(ctx context.Context) {
+	client := &http.Client{Timeout: time.Duration(p.HealthCheck.Timeout)}
+	ticker := time.NewTicker(time.Duration(p.HealthCheck.Interval))
+	defer ticker.Stop()
+
+	for {
+		set := p.currentRules()
+		if set.cloudURL != "" {
+			candidates := set.candidates()
+			results := make([]probeResult, len(candidates))
+			var wg sync.WaitGroup
+			for i, candidate := range candidates {
+				target, err := p.probeTarget(candidate.cloudURL)
+				results[i] = probeResult{cloudURL: candidate.cloudURL, target: target, err: err}
+				if err != nil {
+					p.logger.Error("skipping cloud health check", zap.Error(err))
+					continue
+				}
+				wg.Add(1)
+				go func(res *probeResult) {
+					defer wg.Done()
+					res.err = probe(ctx, client, res.target)
+				}(&results[i])
+			}
+			wg.Wait()
+			if ctx.Err() != nil {
+				return
+			}
+			p.recordHealth(set, results)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe requests a health endpoint; any 2xx response is healthy.
+func probe(ctx context.Context, client *http.Client, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordHealth stores a round of probe outcomes. A cloud's first probe sets
+// its health; after that it takes Fails consecutive failures to mark it down
+// and Passes consecutive successes to mark it up again, so a flaky cloud
+// doesn't flap. Clouds going down or coming back are logged and emitted.
+func (p *PluginInjector) recordHealth(set *ruleSet, results []probeResult) {
+	if p.health == nil {
+		return
+	}
+	wasDown := p.cloudHealth() != nil && p.cloudsDown(set)
+	previous := make(map[string]healthStatus)
+	for _, st := range p.cloudHealth() {
+		previous[st.cloudURL] = st
+	}
+
+	now := time.Now()
+	clouds := make([]healthStatus, 0, len(results))
+	for _, res := range results {
+		if res.target == "" {
+			continue
+		}
+		st := healthStatus{URL: res.target, Healthy: res.err == nil, Checked: now, Since: now, cloudURL: res.cloudURL}
+		if res.err != nil {
+			st.Error = res.err.Error()
+		}
+		prev, seen := previous[res.cloudURL]
+		if seen {
+			st.Healthy, st.Since = prev.Healthy, prev.Since
+			if (res.err == nil) != prev.Healthy {
+				threshold := p.HealthCheck.Fails
+				if !prev.Healthy {
+					threshold = p.HealthCheck.Passes
+				}
+				if st.streak = prev.streak + 1; st.streak >= threshold {
+					st.Healthy, st.Since, st.streak = !prev.Healthy, now, 0
+				}
+			}
+		}
+		clouds = append(clouds, st)
+
+		switch {
+		case seen && prev.Healthy == st.Healthy, !seen && st.Healthy:
+		case st.Healthy:
+			p.logger.Info("cloud is reachable again", zap.String("url", st.URL))
+			p.emit(eventCloudUp, map[string]any{"url": st.URL})
+		default:
+			p.logger.Error("cloud is unreachable",
+				zap.String("url", st.URL),
+				zap.Error(res.err))
+			p.emit(eventCloudDown, map[string]any{"url": st.URL, "error": st.Error})
+		}
+	}
+	p.health.clouds.Store(&clouds)
+
+	if down := p.cloudsDown(set); down && !wasDown {
+		p.logger.Error("every cloud is unreachable, falling back",
+			zap.String("fallback", p.HealthCheck.Fallback))
+	} else if !down && wasDown {
+		p.logger.Info("a cloud is reachable again, no longer falling back")
+	}
+}
@@ -0,0 +1,491 @@
+package vibekanbanplugins
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+)
+
+// newHealthServer starts a cloud whose /health endpoint reports the status held in up
+func newHealthServer(t *testing.T, up *atomic.Bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// waitForCloudStatus polls until the injector's health check reports status
+func waitForCloudStatus(t *testing.T, injector *PluginInjector, status string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for injector.cloudStatus() != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected cloud status %q, got %q", status, injector.cloudStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// serveHTML serves an HTML page through the injector and returns the body
+func serveHTML(t *testing.T, injector *PluginInjector) string {
+	t.Helper()
+	upstream := mockNextHandler([]byte("<html><body></body></html>"), 200, http.Header{"Content-Type": []string{"text/html"}})
+	rec := httptest.NewRecorder()
+	if err := injector.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil), upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	return rec.Body.String()
+}
+
+// Verify each fallback applies while the cloud is down and is lifted once it is back
+func TestHealthCheckFallback(t *testing.T) {
+	js := `fetch("https://api.vibekanban.com/v1")`
+
+	testCases := []struct {
+		name        string
+		fallback    string
+		fallbackURL string
+		downJS      string
+		downBanner  bool
+	}{
+		{"passthrough", fallbackPassthrough, "", js, false},
+		{"cloud_url", fallbackCloudURL, "https://standby.example.com", `fetch("https://standby.example.com/v1")`, false},
+		{"banner", fallbackBanner, "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			var up atomic.Bool
+			up.Store(true)
+			server := newHealthServer(t, &up)
+			injector := &PluginInjector{
+				CloudURL: server.URL,
+				HealthCheck: &HealthCheck{
+					Interval:    caddy.Duration(10 * time.Millisecond),
+					Fallback:    tc.fallback,
+					FallbackURL: tc.fallbackURL,
+				},
+			}
+			if err := injector.Provision(createTestContext(t)); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			t.Cleanup(func() { injector.Cleanup() })
+			rewritten := `fetch("` + server.URL + `/v1")`
+			waitForCloudStatus(t, injector, cloudStatusUp)
+
+			// ASSERT
+			if got := rewriteWith(t, injector, js); got != rewritten {
+				t.Errorf("Expected rewrite to the healthy cloud, got %q", got)
+			}
+
+			// ACT
+			up.Store(false)
+			waitForCloudStatus(t, injector, cloudStatusDown)
+
+			// ASSERT
+			downJS := tc.downJS
+			if downJS == "" {
+				downJS = rewritten
+			}
+			if got := rewriteWith(t, injector, js); got != downJS {
+				t.Errorf("Expected %q while the cloud is down, got %q", downJS, got)
+			}
+			if got := strings.Contains(serveHTML(t, injector), "vk-cloud-offline"); got != tc.downBanner {
+				t.Errorf("Expected offline banner %v, got %v", tc.downBanner, got)
+			}
+			if st := injector.cloudHealth(); len(st) != 1 || st[0].Error == "" || st[0].URL != server.URL+"/health" {
+				t.Errorf("Expected failed probe in status, got %+v", st)
+			}
+
+			// ACT
+			up.Store(true)
+			waitForCloudStatus(t, injector, cloudStatusUp)
+
+			// ASSERT
+			if got := rewriteWith(t, injector, js); got != rewritten {
+				t.Errorf("Expected rewrite to the recovered cloud, got %q", got)
+			}
+			if strings.Contains(serveHTML(t, injector), "vk-cloud-offline") {
+				t.Error("Expected no offline banner once the cloud is back")
+			}
+		})
+	}
+}
+
+// Verify the cloud status is exposed through placeholders and the admin API
+func TestHealthCheckStatus(t *testing.T) {
+	// ARRANGE
+	var up atomic.Bool
+	server := newHealthServer(t, &up)
+	injector := &PluginInjector{
+		Name:        "health-status",
+		CloudURL:    server.URL,
+		HealthCheck: &HealthCheck{Interval: caddy.Duration(10 * time.Millisecond)},
+	}
+	if err := injector.Provision(createTestContext(t)); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	t.Cleanup(func() { injector.Cleanup() })
+	waitForCloudStatus(t, injector, cloudStatusDown)
+	req := withReplacer(httptest.NewRequest("GET", "/assets/index.js", nil))
+	upstream := mockNextHandler([]byte("a"), 200, http.Header{"Content-Type": []string{"application/javascript"}})
+
+	// ACT
+	if err := injector.ServeHTTP(httptest.NewRecorder(), req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	repl := req.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if got, _ := repl.Get(placeholderCloudStatus); got != cloudStatusDown {
+		t.Errorf("Expected {%s} = %q, got %v", placeholderCloudStatus, cloudStatusDown, got)
+	}
+	if got, _ := repl.Get(placeholderCloudURL); got != "" {
+		t.Errorf("Expected no cloud URL while passing through, got %v", got)
+	}
+	status, _ := adminRequest(t, "GET", "/vk/rewrite/health-status", "")
+	if len(status) != 1 || len(status[0].Health) != 1 || status[0].Health[0].Healthy {
+		t.Errorf("Expected unhealthy status from the admin API, got %+v", status)
+	}
+}
+
+// Verify health check settings are validated
+func TestHealthCheckValidation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cloudURL  string
+		check     HealthCheck
+		expectErr string
+	}{
+		{"defaults", "https://vk.example.com", HealthCheck{}, ""},
+		{"unknown fallback", "https://vk.example.com", HealthCheck{Fallback: "retry"}, "unknown fallback"},
+		{"cloud_url without url", "https://vk.example.com", HealthCheck{Fallback: fallbackCloudURL}, "empty cloud URL"},
+		{"url without cloud_url", "https://vk.example.com", HealthCheck{FallbackURL: "https://standby.example.com"}, "requires the cloud_url fallback"},
+		{"relative path", "https://vk.example.com", HealthCheck{Path: "health"}, "must start with /"},
+		{"request placeholder", "https://{http.request.host}", HealthCheck{}, "can't be probed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			check := tc.check
+			check.Interval = caddy.Duration(time.Hour)
+			injector := &PluginInjector{CloudURL: tc.cloudURL, HealthCheck: &check}
+
+			// ACT
+			err := injector.Provision(createTestContext(t))
+			if err == nil {
+				t.Cleanup(func() { injector.Cleanup() })
+				err = injector.Validate()
+			}
+
+			// ASSERT
+			if tc.expectErr == "" {
+				if err != nil {
+					t.Fatalf("Expected valid config, got %v", err)
+				}
+				if check.Path != defaultHealthPath || check.Fallback != fallbackPassthrough {
+					t.Errorf("Expected defaults, got %+v", check)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+// Verify Caddyfile parsing of the health_check block
+func TestUnmarshalCaddyfileHealthCheck(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`vk_rewrite https://vk.example.com {
+		health_check /healthz {
+			interval 10s
+			timeout 2s
+			fails 3
+			passes 5
+			fallback cloud_url https://standby.example.com
+		}
+	}`)
+
+	var p PluginInjector
+	if err := p.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	expected := HealthCheck{
+		Path:        "/healthz",
+		Interval:    caddy.Duration(10 * time.Second),
+		Timeout:     caddy.Duration(2 * time.Second),
+		Fails:       3,
+		Passes:      5,
+		Fallback:    fallbackCloudURL,
+		FallbackURL: "https://standby.example.com",
+	}
+	if p.HealthCheck == nil || *p.HealthCheck != expected {
+		t.Errorf("Expected %+v, got %+v", expected, p.HealthCheck)
+	}
+}
+
+// waitForCloudUp polls until the health check reports cloudURL up or down
+func waitForCloudUp(t *testing.T, injector *PluginInjector, cloudURL string, up bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for injector.cloudHealth() == nil || injector.cloudUp(cloudURL) != up {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s up=%v, got %+v", cloudURL, up, injector.cloudHealth())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// serveJSWithCookie serves a JS response for a session pinned to cloud, if
+// any, and returns the body and the cloud the session is pinned to afterwards
+func serveJSWithCookie(t *testing.T, injector *PluginInjector, cloud string) (string, string) {
+	t.Helper()
+	upstream := mockNextHandler([]byte(`fetch("https://api.vibekanban.com/v1")`), 200,
+		http.Header{"Content-Type": []string{"application/javascript"}})
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	if cloud != "" {
+		req.AddCookie(&http.Cookie{Name: cloudCookie, Value: cloud})
+	}
+	rec := httptest.NewRecorder()
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == cloudCookie {
+			cloud = cookie.Value
+		}
+	}
+	return rec.Body.String(), cloud
+}
+
+// Verify requests fail over between clouds and sessions stay on their cloud
+func TestCloudFailover(t *testing.T) {
+	// ARRANGE
+	var primaryUp, standbyUp atomic.Bool
+	primaryUp.Store(true)
+	standbyUp.Store(true)
+	primary := newHealthServer(t, &primaryUp).URL
+	standby := newHealthServer(t, &standbyUp).URL
+	injector := &PluginInjector{
+		CloudURLs:   []string{primary, standby},
+		HealthCheck: &HealthCheck{Interval: caddy.Duration(10 * time.Millisecond)},
+	}
+	if err := injector.Provision(createTestContext(t)); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	t.Cleanup(func() { injector.Cleanup() })
+	if err := injector.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	waitForCloudStatus(t, injector, cloudStatusUp)
+	rewrittenTo := func(cloudURL string) string { return `fetch("` + cloudURL + `/v1")` }
+
+	steps := []struct {
+		name     string
+		change   func()
+		cookie   string
+		expected string
+		pinned   string
+	}{
+		{"new session uses primary", nil, "", primary, primary},
+		{"primary down moves new sessions", func() {
+			primaryUp.Store(false)
+			waitForCloudUp(t, injector, primary, false)
+		}, "", standby, standby},
+		{"primary down moves pinned sessions", nil, primary, standby, standby},
+		{"pinned session stays after primary recovers", func() {
+			primaryUp.Store(true)
+			waitForCloudUp(t, injector, primary, true)
+		}, standby, standby, standby},
+		{"new session uses recovered primary", nil, "", primary, primary},
+		{"unknown cookie is ignored", nil, "https://evil.example.com", primary, primary},
+		{"every cloud down passes through", func() {
+			primaryUp.Store(false)
+			standbyUp.Store(false)
+			waitForCloudStatus(t, injector, cloudStatusDown)
+		}, primary, `fetch("https://api.vibekanban.com/v1")`, primary},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			// ACT
+			if step.change != nil {
+				step.change()
+			}
+			body, pinned := serveJSWithCookie(t, injector, step.cookie)
+
+			// ASSERT
+			expected := step.expected
+			if expected == primary || expected == standby {
+				expected = rewrittenTo(expected)
+			}
+			if body != expected {
+				t.Errorf("Expected %q, got %q", expected, body)
+			}
+			if pinned != step.pinned {
+				t.Errorf("Expected session pinned to %q, got %q", step.pinned, pinned)
+			}
+		})
+	}
+}
+
+// Verify the session pin survives upstream cookies on responses that are
+// not buffered
+func TestCloudPinWithUpstreamCookies(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stream      bool
+		path        string
+		contentType string
+	}{
+		{"passthrough", false, "/logo.png", "image/png"},
+		{"stream", true, "/assets/index.js", "application/javascript"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			var primaryUp, standbyUp atomic.Bool
+			primaryUp.Store(true)
+			standbyUp.Store(true)
+			primary := newHealthServer(t, &primaryUp).URL
+			standby := newHealthServer(t, &standbyUp).URL
+			injector := &PluginInjector{
+				CloudURLs:   []string{primary, standby},
+				HealthCheck: &HealthCheck{Interval: caddy.Duration(10 * time.Millisecond)},
+				Stream:      tc.stream,
+			}
+			if err := injector.Provision(createTestContext(t)); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+			t.Cleanup(func() { injector.Cleanup() })
+			waitForCloudStatus(t, injector, cloudStatusUp)
+
+			upstream := mockNextHandler([]byte(`fetch("https://api.vibekanban.com/v1")`), 200, http.Header{
+				"Content-Type": []string{tc.contentType},
+				"Set-Cookie":   []string{"session=abc; Path=/"},
+			})
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil), upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			cookies := make(map[string]string)
+			for _, cookie := range rec.Result().Cookies() {
+				cookies[cookie.Name] = cookie.Value
+			}
+			if cookies[cloudCookie] != primary {
+				t.Errorf("Expected session pinned to %q, got %q", primary, cookies[cloudCookie])
+			}
+			if cookies["session"] != "abc" {
+				t.Errorf("Expected upstream cookie to be kept, got %q", cookies["session"])
+			}
+		})
+	}
+}
+
+// Verify a cloud's health only flips after enough consecutive probes
+func TestHealthHysteresis(t *testing.T) {
+	// ARRANGE
+	const cloudURL = "https://vk.example.com"
+	set := &ruleSet{cloudURL: cloudURL}
+	injector := &PluginInjector{
+		HealthCheck: &HealthCheck{Fails: 2, Passes: 3},
+		health:      &healthState{},
+		rules:       newRuleState(set),
+		logger:      zap.NewNop(),
+	}
+	probes := []struct {
+		ok       bool
+		expected bool
+	}{
+		{true, true},
+		{false, true},
+		{true, true},
+		{false, true},
+		{false, false},
+		{true, false},
+		{true, false},
+		{false, false},
+		{true, false},
+		{true, false},
+		{true, true},
+	}
+
+	for i, probe := range probes {
+		// ACT
+		var err error
+		if !probe.ok {
+			err = errors.New("status 503")
+		}
+		injector.recordHealth(set, []probeResult{{cloudURL: cloudURL, target: cloudURL + "/health", err: err}})
+
+		// ASSERT
+		if got := injector.cloudUp(cloudURL); got != probe.expected {
+			t.Errorf("Probe %d: expected up=%v, got %v", i, probe.expected, got)
+		}
+	}
+}
+
+// Verify standby clouds are validated and need a health check
+func TestCloudURLsValidation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		injector  *PluginInjector
+		expectErr string
+	}{
+		{"without health check", &PluginInjector{CloudURLs: []string{"https://a.example.com", "https://b.example.com"}}, "need a health_check"},
+		{"invalid standby", &PluginInjector{
+			CloudURLs:   []string{"https://a.example.com", "b.example.com"},
+			HealthCheck: &HealthCheck{Interval: caddy.Duration(time.Hour)},
+		}, "must start with http:// or https://"},
+		{"with cloud_url", &PluginInjector{CloudURL: "https://a.example.com", CloudURLs: []string{"https://b.example.com"}}, "mutually exclusive"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ACT
+			err := tc.injector.Provision(createTestContext(t))
+			if err == nil {
+				t.Cleanup(func() { tc.injector.Cleanup() })
+				err = tc.injector.Validate()
+			}
+
+			// ASSERT
+			if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+// Verify Caddyfile parsing of several cloud URLs
+func TestUnmarshalCaddyfileCloudURLs(t *testing.T) {
+	d := caddyfile.NewTestDispenser("vk_rewrite https://primary.example.com https://standby.example.com")
+
+	var p PluginInjector
+	if err := p.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.CloudURL != "" || len(p.CloudURLs) != 2 || p.CloudURLs[1] != "https://standby.example.com" {
+		t.Errorf("Expected two cloud URLs, got %q %q", p.CloudURL, p.CloudURLs)
+	}
+}
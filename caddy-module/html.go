@@ -0,0 +1,147 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// Injection points in an HTML document.
+const (
+	injectHeadStart = "head-start" // right after the opening <head> tag
+	injectHeadEnd   = "head-end"   // right before </head>
+	injectBodyEnd   = "body-end"   // right before the last </body>
+)
+
+// htmlSnippet is markup to insert at an injection point.
+type htmlSnippet struct {
+	at   string
+	html string
+}
+
+// htmlOffsets records where each injection point falls in the output.
+// A value of -1 means the document has no such point.
+type htmlOffsets struct {
+	headStart int
+	headEnd   int
+	bodyEnd   int
+}
+
+// rewriteHTML tokenizes an HTML document, applies rules to everything except
+// comments and <template> contents, and inserts snippets at their injection
+// points. Token bytes are passed through verbatim, so markup the tokenizer
+// considers malformed survives unchanged. It returns the new document, the
+// number of replacements, and whether any snippet was inserted.
+func rewriteHTML(doc []byte, rules []*activeRule, snippets []htmlSnippet) ([]byte, int, bool) {
+	out := make([]byte, 0, len(doc))
+	offsets := htmlOffsets{headStart: -1, headEnd: -1, bodyEnd: -1}
+	total := 0
+	templateDepth := 0
+	consumed := 0
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Markup cut off at the end of the document (an unfinished tag or
+			// an unclosed attribute quote) never becomes a token; keep it as is
+			out = append(out, doc[consumed:]...)
+			break
+		}
+
+		// TagName lowercases the tokenizer's buffer in place, so keep a copy
+		// of the raw bytes to pass uppercase markup through untouched
+		raw := append([]byte(nil), z.Raw()...)
+		consumed += len(raw)
+		tag, _ := z.TagName()
+
+		switch tt {
+		case html.StartTagToken:
+			switch string(tag) {
+			case "template":
+				templateDepth++
+			case "body":
+				// No </head> seen: head-end falls right before <body>
+				if templateDepth == 0 && offsets.headEnd == -1 {
+					offsets.headEnd = len(out)
+				}
+			}
+		case html.EndTagToken:
+			switch string(tag) {
+			case "template":
+				if templateDepth > 0 {
+					templateDepth--
+				}
+			case "head":
+				if templateDepth == 0 && offsets.headEnd == -1 {
+					offsets.headEnd = len(out)
+				}
+			case "body":
+				if templateDepth == 0 {
+					offsets.bodyEnd = len(out)
+				}
+			}
+		}
+
+		if tt == html.CommentToken || templateDepth > 0 {
+			out = append(out, raw...)
+		} else {
+			rewritten, n := applyRules(rules, raw)
+			total += n
+			out = append(out, rewritten...)
+		}
+
+		if tt == html.StartTagToken && string(tag) == "head" && templateDepth == 0 && offsets.headStart == -1 {
+			offsets.headStart = len(out)
+		}
+	}
+
+	out, injected := insertSnippets(out, offsets, snippets)
+	return out, total, injected
+}
+
+// insertSnippets inserts each snippet at its recorded offset, in config order
+// for snippets sharing a point. Snippets whose point is missing are skipped.
+func insertSnippets(doc []byte, offsets htmlOffsets, snippets []htmlSnippet) ([]byte, bool) {
+	type insertion struct {
+		offset int
+		html   string
+	}
+
+	var insertions []insertion
+	for _, s := range snippets {
+		offset := -1
+		switch s.at {
+		case injectHeadStart:
+			offset = offsets.headStart
+		case injectHeadEnd:
+			offset = offsets.headEnd
+		case injectBodyEnd:
+			offset = offsets.bodyEnd
+		}
+		if offset >= 0 {
+			insertions = append(insertions, insertion{offset, s.html})
+		}
+	}
+	if len(insertions) == 0 {
+		return doc, false
+	}
+	sort.SliceStable(insertions, func(i, j int) bool { return insertions[i].offset < insertions[j].offset })
+
+	size := len(doc)
+	for _, ins := range insertions {
+		size += len(ins.html)
+	}
+
+	out := make([]byte, 0, size)
+	last := 0
+	for _, ins := range insertions {
+		out = append(out, doc[last:ins.offset]...)
+		out = append(out, ins.html...)
+		last = ins.offset
+	}
+	out = append(out, doc[last:]...)
+
+	return out, true
+}
@@ -0,0 +1,223 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// Verify snippets land at each injection point in config order
+func TestRewriteHTMLInjectionPoints(t *testing.T) {
+	snippets := []htmlSnippet{
+		{at: injectBodyEnd, html: "<script>a</script>"},
+		{at: injectHeadStart, html: `<meta name="vk">`},
+		{at: injectHeadEnd, html: "<style>x</style>"},
+		{at: injectBodyEnd, html: "<script>b</script>"},
+	}
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"lowercase",
+			`<html><head><title>VK</title></head><body><div></div></body></html>`,
+			`<html><head><meta name="vk"><title>VK</title><style>x</style></head><body><div></div><script>a</script><script>b</script></body></html>`,
+		},
+		{
+			"uppercase",
+			`<HTML><HEAD></HEAD><BODY></BODY></HTML>`,
+			`<HTML><HEAD><meta name="vk"><style>x</style></HEAD><BODY><script>a</script><script>b</script></BODY></HTML>`,
+		},
+		{
+			"attributes and whitespace",
+			`<head data-x="1" ><body class="app"></body >`,
+			`<head data-x="1" ><meta name="vk"><style>x</style><body class="app"><script>a</script><script>b</script></body >`,
+		},
+		{
+			"no head, last body close wins",
+			`<body><script>document.write("</body>")</script></body>`,
+			`<style>x</style><body><script>document.write("</body>")</script><script>a</script><script>b</script></body>`,
+		},
+		{
+			"markers in comments and templates ignored",
+			`<!-- </head></body> --><head></head><body><template><head></head></body></template></body>`,
+			`<!-- </head></body> --><head><meta name="vk"><style>x</style></head><body><template><head></head></body></template><script>a</script><script>b</script></body>`,
+		},
+		{
+			"truncated tail kept",
+			`<head></head><body></body><p a='x`,
+			`<head><meta name="vk"><style>x</style></head><body><script>a</script><script>b</script></body><p a='x`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ACT
+			out, _, injected := rewriteHTML([]byte(tc.input), nil, snippets)
+
+			// ASSERT
+			if !injected {
+				t.Error("Expected snippets to be injected")
+			}
+			if string(out) != tc.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tc.expected, out)
+			}
+		})
+	}
+}
+
+// Verify documents without injection points are left unchanged
+func TestRewriteHTMLMissingPoints(t *testing.T) {
+	testCases := []string{
+		"",
+		"<div>fragment</div>",
+		"<html><body><p>unterminated",
+		"<p <<>> </ div>&amp",
+		"hello <b",
+		"<p a='x",
+		`<div><a href="https://example.com/unclosed`,
+		"<!-- comment never closed",
+		"text </",
+	}
+
+	snippets := []htmlSnippet{{at: injectBodyEnd, html: "<script></script>"}}
+
+	for _, input := range testCases {
+		t.Run(input, func(t *testing.T) {
+			// ACT
+			out, _, injected := rewriteHTML([]byte(input), nil, snippets)
+
+			// ASSERT
+			if injected {
+				t.Error("Expected nothing to be injected")
+			}
+			if string(out) != input {
+				t.Errorf("Expected %q to round-trip, got %q", input, out)
+			}
+		})
+	}
+}
+
+// Verify rules skip comments and <template> contents
+func TestRewriteHTMLSkipsCommentsAndTemplates(t *testing.T) {
+	// ARRANGE
+	rules := []*activeRule{{
+		RewriteRule: RewriteRule{From: "https://api.vibekanban.com"},
+		to:          []byte("https://vk.example.com"),
+	}}
+	input := `<!-- https://api.vibekanban.com --><a href="https://api.vibekanban.com">x</a>` +
+		`<template><a href="https://api.vibekanban.com"></a></template>` +
+		`<script>fetch("https://api.vibekanban.com")</script>`
+	expected := `<!-- https://api.vibekanban.com --><a href="https://vk.example.com">x</a>` +
+		`<template><a href="https://api.vibekanban.com"></a></template>` +
+		`<script>fetch("https://vk.example.com")</script>`
+
+	// ACT
+	out, count, _ := rewriteHTML([]byte(input), rules, nil)
+
+	// ASSERT
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 replacements, got %d", count)
+	}
+}
+
+// Verify configured injections are served alongside the plugin script
+func TestServeHTTPInjections(t *testing.T) {
+	// ARRANGE
+	dir := t.TempDir()
+	stylePath := filepath.Join(dir, "theme.html")
+	if err := os.WriteFile(stylePath, []byte("<style>body{}</style>"), 0o644); err != nil {
+		t.Fatalf("Failed to write injection file: %v", err)
+	}
+
+	upstream := mockNextHandler([]byte("<html><head></head><body></body></html>"), 200, http.Header{
+		"Content-Type": []string{"text/html"},
+	})
+
+	injector := &PluginInjector{
+		DisableInjection: true,
+		Injections: []Injection{
+			{At: injectHeadStart, HTML: `<meta name="vk-cloud">`},
+			{At: injectHeadEnd, File: stylePath},
+		},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	expected := `<html><head><meta name="vk-cloud"><style>body{}</style></head><body></body></html>`
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, rec.Body.String())
+	}
+}
+
+// Verify invalid injections are rejected at provision time
+func TestProvisionRejectsInvalidInjection(t *testing.T) {
+	testCases := []struct {
+		name      string
+		injection Injection
+	}{
+		{"unknown point", Injection{At: "body-start", HTML: "<p>"}},
+		{"empty markup", Injection{At: injectHeadEnd}},
+		{"missing file", Injection{File: "/nonexistent/snippet.html"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			injector := &PluginInjector{Injections: []Injection{tc.injection}}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+// Verify Caddyfile parsing of inject and inject_file
+func TestUnmarshalCaddyfileInjections(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		inject head-start "<meta name=vk>"
+		inject_file head-end /etc/caddy/theme.html
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	expected := []Injection{
+		{At: injectHeadStart, HTML: "<meta name=vk>"},
+		{At: injectHeadEnd, File: "/etc/caddy/theme.html"},
+	}
+	if len(p.Injections) != len(expected) {
+		t.Fatalf("Expected %d injections, got %+v", len(expected), p.Injections)
+	}
+	for i, inj := range expected {
+		if p.Injections[i] != inj {
+			t.Errorf("Injection %d: expected %+v, got %+v", i, inj, p.Injections[i])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package vibekanbanplugins
+
+import (
+	_ "embed"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// defaultScript is the Vibe Kanban Plugin System bootstrap, injected when no
+// script is configured.
+//
+//go:embed assets/plugin-system.js
+var defaultScript string
+
+// loadInjectionScript resolves the script to inject and caches it.
+// Precedence: InjectionScript > InjectionScriptPath > embedded default.
+func (p *PluginInjector) loadInjectionScript() error {
+	switch {
+	case p.DisableInjection:
+		p.cachedScript = ""
+		p.logger.Info("HTML script injection disabled")
+	case p.InjectionScript != "":
+		p.cachedScript = p.InjectionScript
+		p.logger.Info("using inline injection script")
+	case p.InjectionScriptPath != "":
+		script, err := os.ReadFile(p.InjectionScriptPath)
+		if err != nil {
+			return fmt.Errorf("reading injection script: %v", err)
+		}
+		p.cachedScript = string(script)
+		p.logger.Info("loaded injection script from file",
+			zap.String("path", p.InjectionScriptPath))
+	default:
+		p.cachedScript = defaultScript
+		p.logger.Info("using embedded plugin system script")
+	}
+	return nil
+}
+
+// isHTML reports whether the response Content-Type is text/html (case-insensitive).
+func isHTML(headers http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	return err == nil && mediaType == "text/html"
+}
+
+// isJavaScript reports whether the response is a JavaScript document.
+func isJavaScript(headers http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/javascript", "application/javascript", "application/x-javascript":
+		return true
+	}
+	return false
+}
+
+// Injection is a snippet of markup (script, style, meta tag, ...) inserted
+// into HTML pages at a chosen point.
+type Injection struct {
+	// At is the injection point: head-start, head-end or body-end (default)
+	At string `json:"at,omitempty"`
+
+	// HTML is the markup to insert
+	HTML string `json:"html,omitempty"`
+
+	// File is a path to a file containing the markup (used if HTML is empty)
+	File string `json:"file,omitempty"`
+}
+
+// loadInjections validates configured injections and caches their markup,
+// followed by the plugin script at body-end.
+func (p *PluginInjector) loadInjections() error {
+	p.snippets = nil
+	for i, inj := range p.Injections {
+		at := inj.At
+		if at == "" {
+			at = injectBodyEnd
+		}
+		if at != injectHeadStart && at != injectHeadEnd && at != injectBodyEnd {
+			return fmt.Errorf("injection %d: unknown injection point %q (want %s, %s or %s)",
+				i, at, injectHeadStart, injectHeadEnd, injectBodyEnd)
+		}
+
+		markup := inj.HTML
+		if markup == "" && inj.File != "" {
+			data, err := os.ReadFile(inj.File)
+			if err != nil {
+				return fmt.Errorf("injection %d: %v", i, err)
+			}
+			markup = string(data)
+		}
+		if markup == "" {
+			return fmt.Errorf("injection %d: html or file is required", i)
+		}
+
+		p.snippets = append(p.snippets, htmlSnippet{at: at, html: markup})
+	}
+
+	if p.cachedScript != "" {
+		p.snippets = append(p.snippets, htmlSnippet{
+			at:   injectBodyEnd,
+			html: p.scriptTag() + "\n" + p.cachedScript + "\n</script>\n",
+		})
+	}
+
+	return nil
+}
+
+// shouldInject reports whether anything should be injected into a response.
+func (p *PluginInjector) shouldInject(headers http.Header) bool {
+	return (len(p.activeSnippets()) > 0 || p.config != nil) && isHTML(headers)
+}
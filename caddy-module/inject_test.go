@@ -0,0 +1,112 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// Verify injection can be turned off
+func TestDisableInjection(t *testing.T) {
+	// ARRANGE
+	html := []byte("<html><body><h1>Board</h1></body></html>")
+	upstream := mockNextHandler(html, 200, http.Header{
+		"Content-Type": []string{"text/html"},
+	})
+
+	injector := &PluginInjector{DisableInjection: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if injector.cachedScript != "" {
+		t.Error("Expected no cached script when injection is disabled")
+	}
+	if !bytes.Equal(rec.Body.Bytes(), html) {
+		t.Errorf("Expected HTML to be unchanged, got %q", rec.Body.Bytes())
+	}
+}
+
+// Verify valid compressed HTML gets both rewriting and injection
+func TestInjectsIntoEncodedHTML(t *testing.T) {
+	// ARRANGE
+	html := []byte(`<html><body><script>api="https://api.vibekanban.com"</script></body></html>`)
+	encoded, err := encodeBody("gzip", html)
+	if err != nil {
+		t.Fatalf("encodeBody failed: %v", err)
+	}
+	upstream := mockNextHandler(encoded, 200, http.Header{
+		"Content-Type":     []string{"text/html; charset=utf-8"},
+		"Content-Encoding": []string{"gzip"},
+	})
+
+	injector := &PluginInjector{
+		CloudURL:        "https://vk.example.com",
+		InjectionScript: "console.log('encoded');",
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	decoded, err := decodeBody("gzip", rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Response is not valid gzip: %v", err)
+	}
+	if !bytes.Contains(decoded, []byte(`api="https://vk.example.com"`)) {
+		t.Error("Expected cloud URL to be rewritten")
+	}
+	if !bytes.Contains(decoded, []byte("console.log('encoded');")) {
+		t.Error("Expected script to be injected")
+	}
+}
+
+// Verify Caddyfile parsing of injection subdirectives
+func TestUnmarshalCaddyfileInjection(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		inject_script "console.log('inline')"
+		inject_script_file /etc/caddy/plugins.js
+		disable_injection
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.InjectionScript != "console.log('inline')" {
+		t.Errorf("Unexpected inline script %q", p.InjectionScript)
+	}
+	if p.InjectionScriptPath != "/etc/caddy/plugins.js" {
+		t.Errorf("Unexpected script path %q", p.InjectionScriptPath)
+	}
+	if !p.DisableInjection {
+		t.Error("Expected injection to be disabled")
+	}
+}
@@ -0,0 +1,211 @@
+package vibekanbanplugins
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// defaultContentTypes are the media types rewritten when no matcher is
+// configured. Entries without a slash match as substrings, so "javascript"
+// covers application/javascript, text/javascript and application/x-javascript.
+var defaultContentTypes = []string{
+	"javascript",
+	"ecmascript",
+	"text/html",
+	"text/css",
+	"application/json",
+	"application/manifest+json",
+}
+
+// defaultExtensions are the path extensions used to identify rewritable
+// responses that have no Content-Type.
+var defaultExtensions = []string{".js", ".mjs", ".map"}
+
+// ResponseMatcher selects which responses are eligible for rewriting.
+type ResponseMatcher struct {
+	// ContentTypes are matched case-insensitively against the response
+	// Content-Type (parameters such as charset are ignored)
+	ContentTypes []string `json:"content_types,omitempty"`
+
+	// Extensions are request path extensions (e.g. ".js") used as a
+	// fallback when the response has no Content-Type
+	Extensions []string `json:"extensions,omitempty"`
+
+	// Paths restricts the matcher to request paths matching these globs
+	Paths []string `json:"paths,omitempty"`
+
+	// IdentityUpstream asks upstream for uncompressed responses on requests
+	// this matcher may select, so they are rewritten without decoding and
+	// compressed by the module on the way out
+	IdentityUpstream bool `json:"identity_upstream,omitempty"`
+
+	paths caddyhttp.MatchPath
+}
+
+// provision normalizes the matcher's content types, extensions and paths.
+func (m *ResponseMatcher) provision(ctx caddy.Context) error {
+	for i, ct := range m.ContentTypes {
+		m.ContentTypes[i] = strings.ToLower(strings.TrimSpace(ct))
+	}
+	for i, ext := range m.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		m.Extensions[i] = ext
+	}
+	if len(m.ContentTypes) == 0 && len(m.Extensions) == 0 {
+		return fmt.Errorf("matcher needs at least one content type or extension")
+	}
+	return provisionPaths(ctx, m.Paths, &m.paths)
+}
+
+// matchResponse reports whether the request/response pair is selected.
+func (m ResponseMatcher) matchResponse(r *http.Request, headers http.Header) bool {
+	if !matchPaths(m.paths, r) {
+		return false
+	}
+
+	contentType := headers.Get("Content-Type")
+	if contentType == "" {
+		ext := strings.ToLower(path.Ext(r.URL.Path))
+		for _, want := range m.Extensions {
+			if ext == want {
+				return true
+			}
+		}
+		return false
+	}
+	return m.matchContentType(contentType)
+}
+
+// matchContentType reports whether a Content-Type value is selected.
+func (m ResponseMatcher) matchContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	for _, want := range m.ContentTypes {
+		if mediaType == want || (!strings.Contains(want, "/") && strings.Contains(mediaType, want)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatchPath reports whether the matcher could select the response to a
+// request before it exists, guessing the Content-Type from the path
+// extension. Paths without an extension are assumed to be pages.
+func (m ResponseMatcher) mayMatchPath(r *http.Request) bool {
+	if !matchPaths(m.paths, r) {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(r.URL.Path))
+	if ext == "" {
+		return true
+	}
+	for _, want := range m.Extensions {
+		if ext == want {
+			return true
+		}
+	}
+	contentType := mime.TypeByExtension(ext)
+	return contentType != "" && m.matchContentType(contentType)
+}
+
+// provisionPaths copies globs into a path matcher, normalizing them the way
+// Caddy's own path matcher does. An empty list leaves dst nil (match all).
+func provisionPaths(ctx caddy.Context, globs []string, dst *caddyhttp.MatchPath) error {
+	if len(globs) == 0 {
+		*dst = nil
+		return nil
+	}
+	m := make(caddyhttp.MatchPath, len(globs))
+	copy(m, globs)
+	if err := m.Provision(ctx); err != nil {
+		return err
+	}
+	*dst = m
+	return nil
+}
+
+// matchPaths reports whether the request path matches any glob. A nil
+// matcher matches every request.
+func matchPaths(m caddyhttp.MatchPath, r *http.Request) bool {
+	if m == nil {
+		return true
+	}
+	// The path matcher expands placeholders, so it needs a replacer
+	if _, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); !ok {
+		r = r.WithContext(context.WithValue(r.Context(), caddy.ReplacerCtxKey, caddy.NewReplacer()))
+	}
+	match, err := m.MatchWithError(r)
+	return err == nil && match
+}
+
+// matchesResponse reports whether any configured matcher selects the response.
+func (p *PluginInjector) matchesResponse(r *http.Request, headers http.Header) bool {
+	for _, m := range p.matchers {
+		if m.matchResponse(r, headers) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayTransformPath reports whether a request could get a response this
+// handler transforms, judged from the request alone.
+func (p *PluginInjector) mayTransformPath(r *http.Request) bool {
+	if len(p.activeSnippets()) > 0 || p.config != nil {
+		switch strings.ToLower(path.Ext(r.URL.Path)) {
+		case "", ".html", ".htm":
+			return true
+		}
+	}
+	if len(p.rulesFor(r)) == 0 {
+		return false
+	}
+	for _, m := range p.matchers {
+		if m.mayMatchPath(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// identityUpstream reports whether a request should be sent upstream with
+// Accept-Encoding: identity because an opted-in matcher may transform it.
+func (p *PluginInjector) identityUpstream(r *http.Request) bool {
+	if len(p.rulesFor(r)) == 0 && len(p.activeSnippets()) == 0 && p.config == nil {
+		return false
+	}
+	for _, m := range p.matchers {
+		if m.IdentityUpstream && m.mayMatchPath(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesFor returns the rules whose path scope includes the request.
+func (p *PluginInjector) rulesFor(r *http.Request) []RewriteRule {
+	set := p.servingRules(r)
+	if !set.scoped {
+		return set.rules
+	}
+
+	rules := make([]RewriteRule, 0, len(set.rules))
+	for _, rule := range set.rules {
+		if matchPaths(rule.paths, r) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,206 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// Verify the default matcher covers the content VK emits the API base in
+func TestDefaultMatcherContentTypes(t *testing.T) {
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		expected    bool
+	}{
+		{"javascript", "/assets/index.js", "application/javascript; charset=utf-8", true},
+		{"text javascript", "/assets/index.js", "text/javascript", true},
+		{"html", "/", "text/html; charset=utf-8", true},
+		{"uppercase html", "/", "TEXT/HTML", true},
+		{"json", "/api/info", "application/json", true},
+		{"css", "/assets/index.css", "text/css", true},
+		{"manifest", "/manifest.webmanifest", "application/manifest+json", true},
+		{"image", "/logo.png", "image/png", false},
+		{"font", "/font.woff2", "font/woff2", false},
+		{"missing type js extension", "/assets/index.js", "", true},
+		{"missing type mjs extension", "/assets/worker.MJS", "", true},
+		{"missing type source map", "/assets/index.js.map", "", true},
+		{"missing type no extension", "/", "", false},
+		{"missing type other extension", "/logo.png", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			headers := http.Header{}
+			if tc.contentType != "" {
+				headers.Set("Content-Type", tc.contentType)
+			}
+			if got := injector.matchesResponse(req, headers); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// Verify configured matchers replace the defaults and honour path globs
+func TestConfiguredMatcher(t *testing.T) {
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Match: []ResponseMatcher{{
+			ContentTypes: []string{"application/json"},
+			Paths:        []string{"/api/*"},
+		}},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	json := http.Header{"Content-Type": {"application/json"}}
+	js := http.Header{"Content-Type": {"application/javascript"}}
+
+	if !injector.matchesResponse(httptest.NewRequest("GET", "/api/config", nil), json) {
+		t.Error("Expected JSON under /api/ to match")
+	}
+	if injector.matchesResponse(httptest.NewRequest("GET", "/other/config", nil), json) {
+		t.Error("Expected JSON outside /api/ not to match")
+	}
+	if injector.matchesResponse(httptest.NewRequest("GET", "/api/index.js", nil), js) {
+		t.Error("Expected JavaScript not to match a JSON-only matcher")
+	}
+}
+
+// Verify a matcher without content types or extensions is rejected
+func TestProvisionRejectsEmptyMatcher(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		Match: []ResponseMatcher{{Paths: []string{"/assets/*"}}},
+	}
+
+	// ACT
+	ctx := createTestContext(t)
+	err := injector.Provision(ctx)
+
+	// ASSERT
+	if err == nil {
+		t.Error("Expected error for empty matcher, got nil")
+	}
+}
+
+// Verify rules scoped to path globs only apply to matching requests
+func TestRulePathScope(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		Rules: []RewriteRule{
+			{From: "https://relay.vibekanban.com", To: "https://relay.example.com", Paths: []string{"/assets/*"}},
+		},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	original := []byte(`{"relay":"https://relay.vibekanban.com"}`)
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/assets/index.js", `{"relay":"https://relay.example.com"}`},
+		{"/api/info", `{"relay":"https://relay.vibekanban.com"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			upstream := mockNextHandler(original, 200, http.Header{
+				"Content-Type": []string{"application/json"},
+			})
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if !bytes.Equal(rec.Body.Bytes(), []byte(tc.expected)) {
+				t.Errorf("Expected %q, got %q", tc.expected, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+// Verify the API base in inline HTML config is rewritten
+func TestRewritesInlineHTMLConfig(t *testing.T) {
+	// ARRANGE
+	html := []byte(`<html><head><script>window.VK_API="https://api.vibekanban.com";</script></head></html>`)
+	upstream := mockNextHandler(html, 200, http.Header{
+		"Content-Type": []string{"text/html; charset=utf-8"},
+	})
+
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`window.VK_API="https://vk.example.com"`)) {
+		t.Errorf("Expected inline config to be rewritten, got %q", rec.Body.Bytes())
+	}
+}
+
+// Verify Caddyfile parsing of match blocks and rule path scopes
+func TestUnmarshalCaddyfileMatch(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		rule https://relay.vibekanban.com https://relay.example.com {
+			path /assets/* /sw.js
+		}
+		match {
+			content_type text/html application/json
+			extension .js
+			path /assets/*
+			identity_upstream
+		}
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if len(p.Rules) != 1 || len(p.Rules[0].Paths) != 2 {
+		t.Fatalf("Expected one rule with two paths, got %+v", p.Rules)
+	}
+	if len(p.Match) != 1 {
+		t.Fatalf("Expected one matcher, got %d", len(p.Match))
+	}
+	m := p.Match[0]
+	if len(m.ContentTypes) != 2 || len(m.Extensions) != 1 || len(m.Paths) != 1 || !m.IdentityUpstream {
+		t.Errorf("Unexpected matcher %+v", m)
+	}
+}
@@ -0,0 +1,167 @@
+package vibekanbanplugins
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Modes rewrite latency is reported by.
+const (
+	modeBufferLabel = "buffer"
+	modeStreamLabel = "stream"
+)
+
+// Reasons a response that rules were in scope for was left untouched.
+const (
+	skipEncoding    = "encoding"
+	skipContentType = "content_type"
+)
+
+// metrics are the handler's Prometheus collectors. Instances provisioned
+// against the same registry share them; a nil *metrics records nothing.
+type metrics struct {
+	buffered      prometheus.Counter
+	bufferedBytes prometheus.Counter
+	replacements  *prometheus.CounterVec
+	upgrades      prometheus.Counter
+	skipped       *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+}
+
+// newMetrics creates the collectors and registers them, reusing any that an
+// earlier instance already registered.
+func newMetrics(registry prometheus.Registerer) (*metrics, error) {
+	const ns, sub = "caddy", "vk_rewrite"
+	m := &metrics{
+		buffered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "responses_buffered_total",
+			Help:      "Responses buffered in full for rewriting.",
+		}),
+		bufferedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "buffered_bytes_total",
+			Help:      "Upstream response bytes buffered for rewriting.",
+		}),
+		replacements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "replacements_total",
+			Help:      "Replacements made, by rule: cloud_url, the index of a configured rule, or other.",
+		}, []string{"rule"}),
+		upgrades: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "upgrade_bypasses_total",
+			Help:      "Protocol upgrade requests passed through without rewriting.",
+		}),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "responses_skipped_total",
+			Help:      "Responses rules were in scope for but left untouched, by reason.",
+		}, []string{"reason"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "rewrite_duration_seconds",
+			Help:      "Time spent transforming response bodies, by mode.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"mode"}),
+	}
+
+	var err error
+	if m.buffered, err = register(registry, m.buffered); err != nil {
+		return nil, err
+	}
+	if m.bufferedBytes, err = register(registry, m.bufferedBytes); err != nil {
+		return nil, err
+	}
+	if m.replacements, err = register(registry, m.replacements); err != nil {
+		return nil, err
+	}
+	if m.upgrades, err = register(registry, m.upgrades); err != nil {
+		return nil, err
+	}
+	if m.skipped, err = register(registry, m.skipped); err != nil {
+		return nil, err
+	}
+	if m.duration, err = register(registry, m.duration); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// register adds a collector to the registry, returning the one already
+// registered under the same name if there is one.
+func register[T prometheus.Collector](registry prometheus.Registerer, c T) (T, error) {
+	err := registry.Register(c)
+	if err == nil {
+		return c, nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// provisionMetrics registers the collectors with Caddy's metrics registry.
+func (p *PluginInjector) provisionMetrics(registry *prometheus.Registry) error {
+	if registry == nil {
+		return nil
+	}
+	m, err := newMetrics(registry)
+	if err != nil {
+		return err
+	}
+	p.metrics = m
+	return nil
+}
+
+// bufferedResponse records a response held in full for rewriting.
+func (m *metrics) bufferedResponse(size int) {
+	if m == nil {
+		return
+	}
+	m.buffered.Inc()
+	m.bufferedBytes.Add(float64(size))
+}
+
+// rewrote records the replacements one rule made in a response.
+func (m *metrics) rewrote(rule string, count int) {
+	if m == nil || count == 0 {
+		return
+	}
+	m.replacements.WithLabelValues(rule).Add(float64(count))
+}
+
+// upgradeBypassed records a protocol upgrade passed straight through.
+func (m *metrics) upgradeBypassed() {
+	if m == nil {
+		return
+	}
+	m.upgrades.Inc()
+}
+
+// skippedResponse records a response left untouched for the given reason.
+func (m *metrics) skippedResponse(reason string) {
+	if m == nil {
+		return
+	}
+	m.skipped.WithLabelValues(reason).Inc()
+}
+
+// observeRewrite records time spent transforming one response body.
+func (m *metrics) observeRewrite(mode string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(mode).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,110 @@
+package vibekanbanplugins
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Verify the handler's collectors count buffering, rewrites, bypasses and skips
+func TestMetrics(t *testing.T) {
+	// ARRANGE
+	ctx := createTestContext(t)
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	// A second instance in the same config shares the collectors
+	streaming := &PluginInjector{CloudURL: "https://vk.example.com", Stream: true}
+	if err := streaming.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision second injector: %v", err)
+	}
+	if injector.metrics.replacements != streaming.metrics.replacements {
+		t.Error("Expected instances to share registered collectors")
+	}
+
+	serve := func(p *PluginInjector, req *http.Request, body string, headers http.Header) {
+		t.Helper()
+		if err := p.ServeHTTP(httptest.NewRecorder(), req, mockNextHandler([]byte(body), 200, headers)); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+	}
+	js := http.Header{"Content-Type": []string{"application/javascript"}}
+	body := `a("https://api.vibekanban.com");b("https://api.vibekanban.com")`
+
+	// ACT
+	serve(injector, httptest.NewRequest("GET", "/assets/index.js", nil), body, js)
+	serve(streaming, httptest.NewRequest("GET", "/assets/index.js", nil), body, js)
+
+	upgrade := httptest.NewRequest("GET", "/ws", nil)
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	serve(injector, upgrade, "", nil)
+
+	serve(injector, httptest.NewRequest("GET", "/assets/index.js", nil), body, http.Header{
+		"Content-Type":     []string{"application/javascript"},
+		"Content-Encoding": []string{"x-custom"},
+	})
+	serve(injector, httptest.NewRequest("GET", "/logo.png", nil), "png", http.Header{
+		"Content-Type": []string{"image/png"},
+	})
+
+	// ASSERT
+	m := injector.metrics
+	if got := testutil.ToFloat64(m.buffered); got != 1 {
+		t.Errorf("Expected 1 buffered response, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.bufferedBytes); got != float64(len(body)) {
+		t.Errorf("Expected %d buffered bytes, got %v", len(body), got)
+	}
+	if got := testutil.ToFloat64(m.replacements.WithLabelValues("cloud_url")); got != 4 {
+		t.Errorf("Expected 4 replacements across buffered and streamed responses, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.upgrades); got != 1 {
+		t.Errorf("Expected 1 upgrade bypass, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.skipped.WithLabelValues(skipEncoding)); got != 1 {
+		t.Errorf("Expected 1 encoding skip, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.skipped.WithLabelValues(skipContentType)); got != 1 {
+		t.Errorf("Expected 1 content type skip, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 2 {
+		t.Errorf("Expected latency series for buffer and stream modes, got %d", got)
+	}
+}
+
+// Verify replacements are labelled by rule position, not rule contents
+func TestReplacementLabels(t *testing.T) {
+	// ARRANGE
+	rules := make([]RewriteRule, maxRuleLabels+2)
+	for i := range rules {
+		rules[i] = RewriteRule{From: fmt.Sprintf("host%d.example.com", i), To: "vk.example.com"}
+	}
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Rules: rules}
+	if err := injector.Provision(createTestContext(t)); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	body := fmt.Sprintf(`a("https://api.vibekanban.com");b("host1.example.com");c("host%d.example.com");d("host%d.example.com")`,
+		maxRuleLabels, maxRuleLabels+1)
+
+	// ACT
+	upstream := mockNextHandler([]byte(body), 200, http.Header{"Content-Type": []string{"application/javascript"}})
+	if err := injector.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/assets/index.js", nil), upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	m := injector.metrics.replacements
+	for label, expected := range map[string]float64{"cloud_url": 1, "1": 1, "other": 2} {
+		if got := testutil.ToFloat64(m.WithLabelValues(label)); got != expected {
+			t.Errorf("Expected %v replacements labelled %q, got %v", expected, label, got)
+		}
+	}
+	if got := testutil.CollectAndCount(m); got != 3 {
+		t.Errorf("Expected 3 series, got %d", got)
+	}
+}
@@ -0,0 +1,100 @@
+package vibekanbanplugins
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// Placeholders set on every request the handler sees, for use in log
+// fields and header directives:
+//
+//	{http.vk.cloud_url}             the cloud URL rewrites point to
+//	{http.vk.cloud_status}          up, down or unknown, from the health check
+//	{http.vk.rewrite.mode}          buffer, stream, cached or passthrough
+//	{http.vk.rewrite.count}         replacements made in the response
+//	{http.vk.rewrite.rules_matched} rules that made at least one replacement
+//	{http.vk.buffered_bytes}        upstream bytes held in memory for rewriting
+const (
+	placeholderCloudURL      = "http.vk.cloud_url"
+	placeholderCloudStatus   = "http.vk.cloud_status"
+	placeholderMode          = "http.vk.rewrite.mode"
+	placeholderCount         = "http.vk.rewrite.count"
+	placeholderRulesMatched  = "http.vk.rewrite.rules_matched"
+	placeholderBufferedBytes = "http.vk.buffered_bytes"
+)
+
+// Values of {http.vk.rewrite.mode} besides the buffer and stream labels.
+const (
+	modeCachedLabel      = "cached"
+	modePassthroughLabel = "passthrough"
+)
+
+// rewriteStats tallies the replacements made in one response.
+type rewriteStats struct {
+	replacements int
+
+	// rules are the rules that made at least one replacement, in order
+	rules []ruleCount
+}
+
+// ruleCount is the number of replacements one rule made.
+type ruleCount struct {
+	from  string
+	count int
+}
+
+// add counts the replacements each rule made.
+func (s *rewriteStats) add(rules []*activeRule) {
+	if s == nil {
+		return
+	}
+	for _, rule := range rules {
+		if rule.count > 0 {
+			s.replacements += rule.count
+			s.rules = append(s.rules, ruleCount{from: rule.From, count: rule.count})
+		}
+	}
+}
+
+// statsCtxKey is the request context key of the response's rewriteStats.
+type statsCtxKey struct{}
+
+// withStats returns a request that tallies rewrites into stats.
+func withStats(r *http.Request, stats *rewriteStats) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), statsCtxKey{}, stats))
+}
+
+// statsFor returns the tally for the request's response, or nil.
+func statsFor(r *http.Request) *rewriteStats {
+	stats, _ := r.Context().Value(statsCtxKey{}).(*rewriteStats)
+	return stats
+}
+
+// startPlaceholders sets the handler's placeholders to their values for a
+// response that is passed through untouched.
+func (p *PluginInjector) startPlaceholders(r *http.Request) {
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		return
+	}
+	repl.Set(placeholderCloudURL, repl.ReplaceKnown(p.servingRules(r).cloudURL, ""))
+	repl.Set(placeholderCloudStatus, p.cloudStatus())
+	setRewritePlaceholders(repl, modePassthroughLabel, rewriteStats{}, 0)
+}
+
+// finishPlaceholders records how the response was handled.
+func finishPlaceholders(r *http.Request, mode string, stats rewriteStats, buffered int) {
+	if repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); ok {
+		setRewritePlaceholders(repl, mode, stats, buffered)
+	}
+}
+
+// setRewritePlaceholders sets the per-response placeholders.
+func setRewritePlaceholders(repl *caddy.Replacer, mode string, stats rewriteStats, buffered int) {
+	repl.Set(placeholderMode, mode)
+	repl.Set(placeholderCount, stats.replacements)
+	repl.Set(placeholderRulesMatched, len(stats.rules))
+	repl.Set(placeholderBufferedBytes, buffered)
+}
@@ -0,0 +1,77 @@
+package vibekanbanplugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// Verify the handler's placeholders describe how each response was handled
+func TestRewritePlaceholders(t *testing.T) {
+	js := `a("https://api.vibekanban.com");b("https://api.vibekanban.com")`
+	jsHeaders := http.Header{
+		"Content-Type": []string{"application/javascript"},
+		"ETag":         []string{`"v1"`},
+	}
+
+	testCases := []struct {
+		name        string
+		path        string
+		stream      bool
+		headers     http.Header
+		mode        string
+		count       int
+		rulesMatch  int
+		bufferBytes int
+	}{
+		{"buffered", "/assets/index.js", false, jsHeaders, "buffer", 2, 1, len(js)},
+		{"cached", "/assets/index.js", false, jsHeaders, "cached", 2, 1, 0},
+		{"streamed", "/assets/index.js", true, http.Header{"Content-Type": []string{"application/javascript"}}, "stream", 2, 1, 0},
+		{"passthrough", "/logo.png", false, http.Header{"Content-Type": []string{"image/png"}}, "passthrough", 0, 0, 0},
+	}
+
+	// One cached instance so the second case is served from the cache
+	cached := &PluginInjector{CloudURL: "https://{http.request.host}", Cache: true}
+	ctx := createTestContext(t)
+	if err := cached.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+	streaming := &PluginInjector{CloudURL: "https://{http.request.host}", Stream: true}
+	if err := streaming.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := cached
+			if tc.stream {
+				injector = streaming
+			}
+			upstream := mockNextHandler([]byte(js), 200, tc.headers)
+			req := withReplacer(httptest.NewRequest("GET", "http://vk.example.com"+tc.path, nil))
+			repl := req.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+
+			// ACT
+			if err := injector.ServeHTTP(httptest.NewRecorder(), req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			expected := map[string]any{
+				placeholderCloudURL:      "https://vk.example.com",
+				placeholderMode:          tc.mode,
+				placeholderCount:         tc.count,
+				placeholderRulesMatched:  tc.rulesMatch,
+				placeholderBufferedBytes: tc.bufferBytes,
+			}
+			for key, want := range expected {
+				if got, _ := repl.Get(key); got != want {
+					t.Errorf("Expected {%s} = %v, got %v", key, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package vibekanbanplugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// pluginsPath is the reserved path prefix the plugin directory is served under.
+const pluginsPath = "/__vk/plugins/"
+
+// pluginManifestName is the manifest's file name under pluginsPath.
+const pluginManifestName = "manifest.json"
+
+// pluginNamePattern restricts plugin names to safe file name characters.
+var pluginNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// pluginEntry describes one plugin in the manifest.
+type pluginEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// pluginManifest is the JSON document the browser loader fetches.
+type pluginManifest struct {
+	Plugins []pluginEntry `json:"plugins"`
+}
+
+// provisionPlugins validates the plugin directory and enabled plugin names.
+func (p *PluginInjector) provisionPlugins() error {
+	if p.PluginsDir == "" {
+		if len(p.Plugins) > 0 {
+			return fmt.Errorf("plugins require plugins_dir")
+		}
+		return nil
+	}
+
+	info, err := os.Stat(p.PluginsDir)
+	if err != nil {
+		return fmt.Errorf("plugins_dir: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("plugins_dir: %s is not a directory", p.PluginsDir)
+	}
+
+	for _, name := range p.Plugins {
+		if !pluginNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid plugin name %q", name)
+		}
+	}
+
+	p.logger.Info("serving plugins",
+		zap.String("dir", p.PluginsDir),
+		zap.String("path", pluginsPath))
+	return nil
+}
+
+// servesPlugins reports whether a request targets the plugin directory.
+func (p *PluginInjector) servesPlugins(r *http.Request) bool {
+	return p.PluginsDir != "" && strings.HasPrefix(r.URL.Path, pluginsPath)
+}
+
+// servePlugins answers requests under pluginsPath with the manifest or a plugin file.
+func (p *PluginInjector) servePlugins(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return caddyhttp.Error(http.StatusMethodNotAllowed, nil)
+	}
+
+	file := strings.TrimPrefix(r.URL.Path, pluginsPath)
+	if file == pluginManifestName {
+		return p.serveManifest(w, r)
+	}
+
+	name, ok := strings.CutSuffix(file, ".js")
+	if !ok || !p.pluginEnabled(name) {
+		return caddyhttp.Error(http.StatusNotFound, nil)
+	}
+
+	f, err := os.Open(filepath.Join(p.PluginsDir, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return caddyhttp.Error(http.StatusNotFound, err)
+		}
+		return caddyhttp.Error(http.StatusInternalServerError, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return caddyhttp.Error(http.StatusNotFound, err)
+	}
+
+	// Plugins are edited in place, so always revalidate
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, file, info.ModTime(), f)
+	return nil
+}
+
+// serveManifest writes the JSON manifest of enabled plugins.
+func (p *PluginInjector) serveManifest(w http.ResponseWriter, r *http.Request) error {
+	plugins, err := p.listPlugins()
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, err)
+	}
+
+	manifest := pluginManifest{Plugins: []pluginEntry{}}
+	for _, name := range plugins {
+		manifest.Plugins = append(manifest.Plugins, pluginEntry{
+			Name: name,
+			URL:  pluginsPath + name + ".js",
+		})
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+	return nil
+}
+
+// listPlugins returns the enabled plugins present in the directory, in load
+// order: the configured order, or by name when every plugin is enabled.
+// The directory is read per request so plugins can be added without a reload.
+func (p *PluginInjector) listPlugins() ([]string, error) {
+	entries, err := os.ReadDir(p.PluginsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool)
+	var all []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".js")
+		if !ok || !entry.Type().IsRegular() || !pluginNamePattern.MatchString(name) {
+			continue
+		}
+		present[name] = true
+		all = append(all, name)
+	}
+
+	if len(p.Plugins) == 0 {
+		return all, nil
+	}
+
+	var enabled []string
+	for _, name := range p.Plugins {
+		if present[name] {
+			enabled = append(enabled, name)
+		} else {
+			p.logger.Warn("enabled plugin not found", zap.String("plugin", name))
+		}
+	}
+	return enabled, nil
+}
+
+// pluginEnabled reports whether a plugin name may be served.
+func (p *PluginInjector) pluginEnabled(name string) bool {
+	if !pluginNamePattern.MatchString(name) {
+		return false
+	}
+	if len(p.Plugins) == 0 {
+		return true
+	}
+	for _, enabled := range p.Plugins {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptTag returns the opening tag for the injected plugin system script,
+// pointing the loader at the manifest when plugins are served.
+func (p *PluginInjector) scriptTag() string {
+	if p.PluginsDir == "" {
+		return "<script>"
+	}
+	return `<script data-vk-plugins="` + pluginsPath + pluginManifestName + `">`
+}
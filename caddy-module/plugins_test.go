@@ -0,0 +1,254 @@
+package vibekanbanplugins
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// writePlugins creates a plugin directory holding the given files.
+func writePlugins(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write plugin %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// Verify the manifest lists plugin files in load order
+func TestPluginManifest(t *testing.T) {
+	dir := writePlugins(t, map[string]string{
+		"shortcuts.js":     "// shortcuts",
+		"extra-buttons.js": "// buttons",
+		"notes.txt":        "not a plugin",
+	})
+
+	testCases := []struct {
+		name     string
+		enabled  []string
+		expected []pluginEntry
+	}{
+		{"all by name", nil, []pluginEntry{
+			{"extra-buttons", "/__vk/plugins/extra-buttons.js"},
+			{"shortcuts", "/__vk/plugins/shortcuts.js"},
+		}},
+		{"configured order", []string{"shortcuts", "missing", "extra-buttons"}, []pluginEntry{
+			{"shortcuts", "/__vk/plugins/shortcuts.js"},
+			{"extra-buttons", "/__vk/plugins/extra-buttons.js"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{PluginsDir: dir, Plugins: tc.enabled}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+
+			upstream := mockNextHandler([]byte("upstream"), 200, http.Header{})
+			req := httptest.NewRequest("GET", "/__vk/plugins/manifest.json", nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %q", ct)
+			}
+			var manifest pluginManifest
+			if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+				t.Fatalf("Invalid manifest %q: %v", rec.Body.String(), err)
+			}
+			if len(manifest.Plugins) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, manifest.Plugins)
+			}
+			for i, entry := range tc.expected {
+				if manifest.Plugins[i] != entry {
+					t.Errorf("Plugin %d: expected %v, got %v", i, entry, manifest.Plugins[i])
+				}
+			}
+		})
+	}
+}
+
+// Verify plugin files are served and everything else under the prefix is not
+func TestServePluginFiles(t *testing.T) {
+	dir := writePlugins(t, map[string]string{
+		"shortcuts.js": "console.log('shortcuts');",
+		"disabled.js":  "console.log('disabled');",
+	})
+	injector := &PluginInjector{PluginsDir: dir, Plugins: []string{"shortcuts"}}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"enabled plugin", "GET", "/__vk/plugins/shortcuts.js", http.StatusOK},
+		{"disabled plugin", "GET", "/__vk/plugins/disabled.js", http.StatusNotFound},
+		{"missing plugin", "GET", "/__vk/plugins/other.js", http.StatusNotFound},
+		{"traversal", "GET", "/__vk/plugins/..%2fplugins_test.go", http.StatusNotFound},
+		{"not javascript", "GET", "/__vk/plugins/shortcuts", http.StatusNotFound},
+		{"wrong method", "POST", "/__vk/plugins/shortcuts.js", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := mockNextHandler([]byte("upstream"), 200, http.Header{})
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			// ACT
+			err := injector.ServeHTTP(rec, req, upstream)
+
+			// ASSERT
+			if tc.status == http.StatusOK {
+				if err != nil {
+					t.Fatalf("Handler returned error: %v", err)
+				}
+				if rec.Body.String() != "console.log('shortcuts');" {
+					t.Errorf("Unexpected body %q", rec.Body.String())
+				}
+				if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+					t.Errorf("Expected JavaScript content type, got %q", ct)
+				}
+				return
+			}
+			var handlerErr caddyhttp.HandlerError
+			if !errors.As(err, &handlerErr) || handlerErr.StatusCode != tc.status {
+				t.Errorf("Expected %d error, got %v", tc.status, err)
+			}
+		})
+	}
+}
+
+// Verify the injected script points the loader at the manifest
+func TestInjectsPluginLoader(t *testing.T) {
+	// ARRANGE
+	dir := writePlugins(t, map[string]string{"shortcuts.js": ""})
+	upstream := mockNextHandler([]byte("<html><body></body></html>"), 200, http.Header{
+		"Content-Type": []string{"text/html"},
+	})
+
+	injector := &PluginInjector{PluginsDir: dir}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	body := rec.Body.String()
+	if !strings.Contains(body, `<script data-vk-plugins="/__vk/plugins/manifest.json">`) {
+		t.Errorf("Expected loader script tag, got %q", body)
+	}
+	if !strings.Contains(body, "loadPlugins(manifestURL)") {
+		t.Error("Expected embedded plugin system to be injected")
+	}
+}
+
+// Verify the reserved path is proxied when no plugin directory is configured
+func TestPluginsPathWithoutDir(t *testing.T) {
+	// ARRANGE
+	upstream := mockNextHandler([]byte("upstream"), 200, http.Header{
+		"Content-Type": []string{"text/plain"},
+	})
+
+	injector := &PluginInjector{}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/__vk/plugins/manifest.json", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if rec.Body.String() != "upstream" {
+		t.Errorf("Expected upstream response, got %q", rec.Body.String())
+	}
+}
+
+// Verify invalid plugin configuration is rejected at provision time
+func TestProvisionRejectsInvalidPlugins(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plugin.js")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		injector *PluginInjector
+	}{
+		{"missing dir", &PluginInjector{PluginsDir: "/nonexistent/plugins"}},
+		{"not a dir", &PluginInjector{PluginsDir: file}},
+		{"plugins without dir", &PluginInjector{Plugins: []string{"shortcuts"}}},
+		{"bad name", &PluginInjector{PluginsDir: filepath.Dir(file), Plugins: []string{"../etc"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := createTestContext(t)
+			if err := tc.injector.Provision(ctx); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+// Verify Caddyfile parsing of plugin subdirectives
+func TestUnmarshalCaddyfilePlugins(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		plugins_dir /srv/vk-plugins
+		plugins shortcuts extra-buttons
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.PluginsDir != "/srv/vk-plugins" {
+		t.Errorf("Unexpected plugins dir %q", p.PluginsDir)
+	}
+	if strings.Join(p.Plugins, ",") != "shortcuts,extra-buttons" {
+		t.Errorf("Unexpected plugins %v", p.Plugins)
+	}
+}
@@ -0,0 +1,103 @@
+package vibekanbanplugins
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// byteRange is a single satisfiable range of a body of known size.
+type byteRange struct {
+	start, length, size int64
+}
+
+// contentRange formats the range as a Content-Range value.
+func (b byteRange) contentRange() string {
+	return fmt.Sprintf("bytes %d-%d/%d", b.start, b.start+b.length-1, b.size)
+}
+
+// passthroughRange works out the slice of an untransformed response the
+// client asked for after its Range was withheld from upstream, so the slice
+// can be cut as the body streams through. It returns nil to send the whole
+// response when If-Range no longer matches, and reports false when the slice
+// can't be cut in-stream (unknown length, several ranges, or a range that
+// isn't satisfiable) and the body has to be buffered instead.
+func passthroughRange(client *http.Request, headers http.Header) (*byteRange, bool) {
+	if !ifRangeMatches(client.Header.Get("If-Range"), headers) {
+		return nil, true
+	}
+	size, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+	if err != nil || size <= 0 {
+		return nil, false
+	}
+	spec, found := strings.CutPrefix(strings.TrimSpace(client.Header.Get("Range")), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return nil, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return nil, false
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, false
+		}
+		n = min(n, size)
+		return &byteRange{start: size - n, length: n, size: size}, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return nil, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, false
+		}
+		end = min(end, size-1)
+	}
+	return &byteRange{start: start, length: end - start + 1, size: size}, true
+}
+
+// ifRangeMatches evaluates an If-Range value against the response's
+// validators (RFC 9110 section 13.1.5): entity tags compare strongly and
+// dates must equal Last-Modified. An absent If-Range always matches.
+func ifRangeMatches(ifRange string, headers http.Header) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag := strings.TrimSpace(headers.Get("ETag"))
+		return !strings.HasPrefix(ifRange, "W/") && !strings.HasPrefix(etag, "W/") && etag == ifRange
+	}
+	since, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(headers.Get("Last-Modified"))
+	return err == nil && modified.Equal(since)
+}
+
+// writeSlice writes the part of b that falls inside the recorder's range,
+// dropping the rest of the body.
+func (r *responseRecorder) writeSlice(b []byte) (int, error) {
+	n := len(b)
+	skip := min(r.slice.start, int64(len(b)))
+	b, r.slice.start = b[skip:], r.slice.start-skip
+	if int64(len(b)) > r.slice.length {
+		b = b[:r.slice.length]
+	}
+	r.slice.length -= int64(len(b))
+	if len(b) > 0 {
+		if _, err := r.ResponseWriter.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,263 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// rangeUpstream mimics an origin honouring Range, recording what it was sent.
+func rangeUpstream(body []byte, contentType string, seen *http.Header) caddyhttp.Handler {
+	return caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		*seen = r.Header.Clone()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"v1"`)
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(body[start : end+1])
+			return nil
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		return nil
+	})
+}
+
+// Verify ranges of rewritable content are cut from the rewritten body
+func TestRangeOfRewrittenBody(t *testing.T) {
+	// ARRANGE
+	original := []byte(`const api = "https://api.vibekanban.com/v1"; // tail`)
+	rewritten := bytes.ReplaceAll(original, []byte("https://api.vibekanban.com"), []byte("https://vk.example.com"))
+
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	var seen http.Header
+	upstream := rangeUpstream(original, "application/javascript", &seen)
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	req.Header.Set("Range", "bytes=13-40")
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if seen.Get("Range") != "" {
+		t.Errorf("Expected Range to be withheld from upstream, got %q", seen.Get("Range"))
+	}
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Expected 206, got %d", rec.Code)
+	}
+	expectedRange := fmt.Sprintf("bytes 13-40/%d", len(rewritten))
+	if got := rec.Header().Get("Content-Range"); got != expectedRange {
+		t.Errorf("Expected Content-Range %q, got %q", expectedRange, got)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), rewritten[13:41]) {
+		t.Errorf("Expected %q, got %q", rewritten[13:41], rec.Body.Bytes())
+	}
+	if got := rec.Header().Get("Content-Length"); got != "28" {
+		t.Errorf("Expected Content-Length 28, got %q", got)
+	}
+}
+
+// Verify If-Range with a stale validator yields the whole rewritten body
+func TestRangeWithStaleIfRange(t *testing.T) {
+	// ARRANGE
+	original := []byte(`fetch("https://api.vibekanban.com/v1")`)
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	var seen http.Header
+	upstream := rangeUpstream(original, "application/javascript", &seen)
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	req.Header.Set("If-Range", `"v1"`)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if seen.Get("If-Range") != "" {
+		t.Error("Expected If-Range to be withheld from upstream")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a stale If-Range, got %d", rec.Code)
+	}
+	if rec.Body.String() != `fetch("https://vk.example.com/v1")` {
+		t.Errorf("Unexpected body %q", rec.Body.String())
+	}
+}
+
+// Verify ranges of content that is never transformed reach upstream untouched
+func TestRangePassthrough(t *testing.T) {
+	testCases := []struct {
+		name          string
+		path          string
+		contentType   string
+		upstreamRange string
+	}{
+		{"video", "/media/demo.mp4", "video/mp4", "bytes=2-5"},
+		{"script path serving binary", "/assets/index.js", "application/octet-stream", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			body := []byte("0123456789 https://api.vibekanban.com")
+			injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+
+			var seen http.Header
+			upstream := rangeUpstream(body, tc.contentType, &seen)
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("Range", "bytes=2-5")
+			rec := httptest.NewRecorder()
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if got := seen.Get("Range"); got != tc.upstreamRange {
+				t.Errorf("Expected upstream Range %q, got %q", tc.upstreamRange, got)
+			}
+			if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+				t.Errorf("Expected 206 slice of the untransformed body, got %d %q", rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("ETag") != `"v1"` {
+				t.Errorf("Expected upstream ETag on untransformed body, got %q", rec.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+// Verify an upstream 206 is never rewritten
+func TestUpstreamPartialContentNotRewritten(t *testing.T) {
+	// ARRANGE
+	slice := []byte(`"https://api.vibekanban.com"`)
+	upstream := mockNextHandler(slice, http.StatusPartialContent, http.Header{
+		"Content-Type":  []string{"application/javascript"},
+		"Content-Range": []string{"bytes 10-37/100"},
+	})
+
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/download", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	if !bytes.Equal(rec.Body.Bytes(), slice) {
+		t.Errorf("Expected 206 body untouched, got %q", rec.Body.Bytes())
+	}
+	if rec.Header().Get("Content-Range") != "bytes 10-37/100" {
+		t.Errorf("Expected Content-Range preserved, got %q", rec.Header().Get("Content-Range"))
+	}
+}
+
+// Verify ranges of untransformed responses whose Range was withheld are cut
+// from the body as it streams through
+func TestRangeCutFromPassthroughStream(t *testing.T) {
+	testCases := []struct {
+		name         string
+		rangeHeader  string
+		ifRange      string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"closed range", "bytes=2-5", "", http.StatusPartialContent, "bytes 2-5/20", "2345"},
+		{"range across writes", "bytes=8-11", "", http.StatusPartialContent, "bytes 8-11/20", "89ab"},
+		{"open range", "bytes=15-", "", http.StatusPartialContent, "bytes 15-19/20", "fghij"},
+		{"suffix range", "bytes=-3", "", http.StatusPartialContent, "bytes 17-19/20", "hij"},
+		{"range past the end", "bytes=18-99", "", http.StatusPartialContent, "bytes 18-19/20", "ij"},
+		{"matching If-Range", "bytes=0-1", `"v1"`, http.StatusPartialContent, "bytes 0-1/20", "01"},
+		{"stale If-Range", "bytes=0-1", `"v0"`, http.StatusOK, "", "0123456789abcdefghij"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// ARRANGE
+			injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+			ctx := createTestContext(t)
+			if err := injector.Provision(ctx); err != nil {
+				t.Fatalf("Failed to provision injector: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			var seen http.Header
+			var sentEarly bool
+			upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				seen = r.Header.Clone()
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Header().Set("Content-Length", "20")
+				w.Header().Set("ETag", `"v1"`)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("0123456789"))
+				// Buffered responses only reach the client once upstream is done
+				sentEarly = rec.Header().Get("Content-Type") != ""
+				w.Write([]byte("abcdefghij"))
+				return nil
+			})
+			req := httptest.NewRequest("GET", "/api/download/artifact", nil)
+			req.Header.Set("Range", tc.rangeHeader)
+			if tc.ifRange != "" {
+				req.Header.Set("If-Range", tc.ifRange)
+			}
+
+			// ACT
+			if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+				t.Fatalf("Handler returned error: %v", err)
+			}
+
+			// ASSERT
+			if seen.Get("Range") != "" {
+				t.Errorf("Expected Range to be withheld from upstream, got %q", seen.Get("Range"))
+			}
+			if !sentEarly {
+				t.Error("Expected the response to reach the client before upstream finished")
+			}
+			if rec.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tc.contentRange {
+				t.Errorf("Expected Content-Range %q, got %q", tc.contentRange, got)
+			}
+			if got := rec.Header().Get("Content-Length"); got != fmt.Sprint(len(tc.body)) {
+				t.Errorf("Expected Content-Length %d, got %q", len(tc.body), got)
+			}
+			if rec.Body.String() != tc.body {
+				t.Errorf("Expected body %q, got %q", tc.body, rec.Body.String())
+			}
+		})
+	}
+}
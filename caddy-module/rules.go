@@ -0,0 +1,262 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// officialCloudURL is the official VK cloud API URL that appears in the npm package bundle.
+const officialCloudURL = "https://api.vibekanban.com"
+
+// RewriteRule replaces every occurrence of From with To in rewritten responses.
+type RewriteRule struct {
+	// From is the literal string (or regular expression if Regexp is set) to search for
+	From string `json:"from"`
+
+	// To is the replacement string. Caddy placeholders such as
+	// {http.request.host} are expanded per request. For regexp rules,
+	// capture groups can be referenced with $1 or ${name}.
+	To string `json:"to,omitempty"`
+
+	// Regexp treats From as an RE2 regular expression
+	Regexp bool `json:"regexp,omitempty"`
+
+	// Paths scopes the rule to request paths matching these globs
+	// (e.g. /assets/*); the rule applies everywhere if empty
+	Paths []string `json:"paths,omitempty"`
+
+	// re is the compiled pattern for regexp rules
+	re *regexp.Regexp
+
+	paths caddyhttp.MatchPath
+
+	// hits counts the replacements the rule has made since it was built
+	hits *atomic.Int64
+
+	// label names the rule in metrics: cloud_url, its index among the
+	// configured rules, or other past maxRuleLabels
+	label string
+}
+
+// maxRuleLabels bounds how many configured rules get their own metrics
+// series; rules past it share the "other" label.
+const maxRuleLabels = 32
+
+// ruleSet is the rewrite state requests read: the cloud URL and the rules
+// built from it. It is never modified; runtime changes swap in a new one.
+type ruleSet struct {
+	cloudURL string
+	rules    []RewriteRule
+
+	// scoped is set if any rule has a path scope
+	scoped bool
+
+	// standbys are the rule sets for the standby cloud URLs, in order
+	standbys []*ruleSet
+
+	// fallback is the rule set served while every cloud is down, if the
+	// health check's fallback changes the cloud URL
+	fallback *ruleSet
+
+	// mixedContentWarned is set once an http cloud URL was served to an https site
+	mixedContentWarned atomic.Bool
+}
+
+// ruleState holds the live rule set.
+type ruleState struct {
+	current atomic.Pointer[ruleSet]
+}
+
+// newRuleState creates a rule state holding set.
+func newRuleState(set *ruleSet) *ruleState {
+	s := &ruleState{}
+	s.current.Store(set)
+	return s
+}
+
+// buildRuleSet provisions rules into a rule set, with the cloud URL
+// rewrite (if any) first.
+func buildRuleSet(ctx caddy.Context, cloudURL string, rules []RewriteRule) (*ruleSet, error) {
+	set := &ruleSet{cloudURL: cloudURL}
+	if cloudURL != "" {
+		set.rules = append(set.rules, RewriteRule{From: officialCloudURL, To: cloudURL, label: "cloud_url"})
+	}
+	for i, rule := range rules {
+		if err := rule.provision(ctx); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		rule.label = "other"
+		if i < maxRuleLabels {
+			rule.label = strconv.Itoa(i)
+		}
+		set.rules = append(set.rules, rule)
+	}
+	for i := range set.rules {
+		set.rules[i].hits = new(atomic.Int64)
+		if set.rules[i].paths != nil {
+			set.scoped = true
+		}
+	}
+	return set, nil
+}
+
+// currentRules returns the live rule set.
+func (p *PluginInjector) currentRules() *ruleSet {
+	if p.rules == nil {
+		return &ruleSet{}
+	}
+	return p.rules.current.Load()
+}
+
+// provision validates the rule, compiles its pattern and path scope.
+func (rule *RewriteRule) provision(ctx caddy.Context) error {
+	if rule.From == "" {
+		return fmt.Errorf("'from' must not be empty")
+	}
+	if rule.Regexp {
+		re, err := regexp.Compile(rule.From)
+		if err != nil {
+			return fmt.Errorf("compiling pattern %q: %v", rule.From, err)
+		}
+		rule.re = re
+	}
+	return provisionPaths(ctx, rule.Paths, &rule.paths)
+}
+
+// apply replaces all matches of the rule in body with the expanded replacement.
+// It returns the rewritten body and the number of replacements made.
+func (rule RewriteRule) apply(body, to []byte) ([]byte, int) {
+	if rule.re != nil {
+		return replaceRegexp(rule.re, body, to)
+	}
+
+	from := []byte(rule.From)
+
+	// Count occurrences for logging
+	count := bytes.Count(body, from)
+	if count == 0 {
+		// No rewrites needed
+		return body, 0
+	}
+
+	// Replace all occurrences
+	return bytes.ReplaceAll(body, from, to), count
+}
+
+// replaceRegexp replaces all matches of re in body, expanding capture group
+// references in template for each match.
+func replaceRegexp(re *regexp.Regexp, body, template []byte) ([]byte, int) {
+	matches := re.FindAllSubmatchIndex(body, -1)
+	if len(matches) == 0 {
+		return body, 0
+	}
+
+	out := make([]byte, 0, len(body))
+	last := 0
+	for _, m := range matches {
+		out = append(out, body[last:m[0]]...)
+		out = re.Expand(out, template, body, m)
+		last = m[1]
+	}
+	out = append(out, body[last:]...)
+
+	return out, len(matches)
+}
+
+// requestReplacer returns the request's replacer, or an empty one when the
+// handler runs outside of a Caddy server (e.g. in tests).
+func requestReplacer(r *http.Request) *caddy.Replacer {
+	if repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); ok {
+		return repl
+	}
+	return caddy.NewReplacer()
+}
+
+// activeRule is a rule in scope for a request, with placeholders in its
+// replacement expanded.
+type activeRule struct {
+	RewriteRule
+	to    []byte
+	count int
+}
+
+// activeRules returns the rules in scope for the request, in order.
+func (p *PluginInjector) activeRules(r *http.Request) []*activeRule {
+	rules := p.rulesFor(r)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	repl := requestReplacer(r)
+	active := make([]*activeRule, len(rules))
+	for i, rule := range rules {
+		// Expand placeholders per request so rules can depend on the
+		// hostname the browser used (Tailscale names, localhost, ...)
+		active[i] = &activeRule{RewriteRule: rule, to: []byte(repl.ReplaceKnown(rule.To, ""))}
+	}
+	return active
+}
+
+// applyRules runs each rule over body in order, accumulating per-rule counts.
+func applyRules(rules []*activeRule, body []byte) ([]byte, int) {
+	total := 0
+	for _, rule := range rules {
+		var count int
+		body, count = rule.apply(body, rule.to)
+		rule.count += count
+		total += count
+	}
+	return body, total
+}
+
+// logRewrites records which rules fired for a response in the logs and
+// the per-rule replacement counter.
+func (p *PluginInjector) logRewrites(rules []*activeRule) {
+	for _, rule := range rules {
+		p.metrics.rewrote(rule.label, rule.count)
+		if rule.count > 0 && p.logger != nil {
+			p.logger.Debug("rewrote URLs in response",
+				zap.Int("replacements", rule.count),
+				zap.String("from", rule.From),
+				zap.String("to", string(rule.to)),
+				zap.Bool("regexp", rule.Regexp))
+		}
+	}
+}
+
+// reportRewrites logs, tallies and publishes the replacements made in a
+// response once its rewrite is complete.
+func (p *PluginInjector) reportRewrites(r *http.Request, mode string, rules []*activeRule, injected bool) {
+	for _, rule := range rules {
+		if rule.hits != nil {
+			rule.hits.Add(int64(rule.count))
+		}
+	}
+	p.logRewrites(rules)
+	statsFor(r).add(rules)
+	p.emitApplied(r, mode, rules, injected)
+}
+
+// rewriteBody applies the rules in scope for the request, in order, to a body.
+// It returns the rewritten body and the total number of replacements made.
+func (p *PluginInjector) rewriteBody(r *http.Request, body []byte) ([]byte, int) {
+	rules := p.activeRules(r)
+
+	// No-op mode: if no rules apply, pass through without rewriting
+	if len(rules) == 0 {
+		return body, 0
+	}
+
+	body, total := applyRules(rules, body)
+	p.reportRewrites(r, modeBufferLabel, rules, false)
+
+	return body, total
+}
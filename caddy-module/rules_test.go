@@ -0,0 +1,285 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// withReplacer attaches an HTTP replacer to the request, as Caddy's server does
+func withReplacer(req *http.Request) *http.Request {
+	repl := caddyhttp.NewTestReplacer(req)
+	return req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+}
+
+// Verify the cloud URL rule is applied first, followed by configured rules in order
+func TestProvisionBuildsOrderedRules(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Rules: []RewriteRule{
+			{From: "https://docs.vibekanban.com", To: "https://docs.example.com"},
+			{From: "https://relay.vibekanban.com", To: "https://relay.example.com"},
+		},
+	}
+
+	// ACT
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	// ASSERT
+	rules := injector.currentRules().rules
+	expected := []RewriteRule{
+		{From: officialCloudURL, To: "https://vk.example.com"},
+		{From: "https://docs.vibekanban.com", To: "https://docs.example.com"},
+		{From: "https://relay.vibekanban.com", To: "https://relay.example.com"},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(rules))
+	}
+	for i, rule := range expected {
+		if rules[i].From != rule.From || rules[i].To != rule.To {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, rule, rules[i])
+		}
+	}
+}
+
+// Verify rules work without a cloud URL configured
+func TestProvisionRulesWithoutCloudURL(t *testing.T) {
+	// ARRANGE
+	t.Setenv("VK_CLOUD_URL", "")
+	injector := &PluginInjector{
+		Rules: []RewriteRule{{From: "https://docs.vibekanban.com", To: "https://docs.example.com"}},
+	}
+
+	// ACT
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	// ASSERT
+	if rules := injector.currentRules().rules; len(rules) != 1 {
+		t.Fatalf("Expected 1 rule, got %d", len(rules))
+	}
+}
+
+// Verify an empty 'from' is rejected
+func TestProvisionRejectsEmptyFrom(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		Rules: []RewriteRule{{From: "", To: "https://example.com"}},
+	}
+
+	// ACT
+	ctx := createTestContext(t)
+	err := injector.Provision(ctx)
+
+	// ASSERT
+	if err == nil {
+		t.Error("Expected error for empty 'from', got nil")
+	}
+}
+
+// Verify rules are applied in order, so later rules see earlier output
+func TestRewriteAppliesRulesInOrder(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		rules: newRuleState(&ruleSet{rules: []RewriteRule{
+			{From: "https://api.vibekanban.com", To: "https://vk.internal"},
+			{From: "https://vk.internal", To: "https://vk.example.com"},
+		}}),
+	}
+	js := []byte(`const api="https://api.vibekanban.com/v1";`)
+
+	// ACT
+	result, _ := injector.rewriteBody(httptest.NewRequest("GET", "/", nil), js)
+
+	// ASSERT
+	expected := []byte(`const api="https://vk.example.com/v1";`)
+	if !bytes.Equal(result, expected) {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+// Verify all configured hosts are rewritten in a JavaScript response
+func TestServeHTTPRewritesMultipleHosts(t *testing.T) {
+	// ARRANGE
+	originalJS := []byte(`fetch("https://api.vibekanban.com/auth");` +
+		`open("https://docs.vibekanban.com/guide");` +
+		`connect("wss://relay.vibekanban.com");`)
+
+	upstream := mockNextHandler(originalJS, 200, http.Header{
+		"Content-Type": []string{"application/javascript"},
+	})
+
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Rules: []RewriteRule{
+			{From: "https://docs.vibekanban.com", To: "https://docs.example.com"},
+			{From: "wss://relay.vibekanban.com", To: "wss://relay.example.com"},
+		},
+	}
+
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	rec := httptest.NewRecorder()
+
+	// ACT
+	if err := injector.ServeHTTP(rec, req, upstream); err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	// ASSERT
+	expected := []byte(`fetch("https://vk.example.com/auth");` +
+		`open("https://docs.example.com/guide");` +
+		`connect("wss://relay.example.com");`)
+	if !bytes.Equal(rec.Body.Bytes(), expected) {
+		t.Errorf("Expected %q, got %q", expected, rec.Body.Bytes())
+	}
+}
+
+// Verify regexp rules substitute capture groups
+func TestRegexpRuleCaptureGroups(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		Rules: []RewriteRule{
+			{From: `https://([a-z]+)\.vibekanban\.com`, To: "https://$1.example.com", Regexp: true},
+		},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	js := []byte(`a="https://docs.vibekanban.com";b="https://relay.vibekanban.com/ws";`)
+
+	// ACT
+	result, _ := injector.rewriteBody(httptest.NewRequest("GET", "/", nil), js)
+
+	// ASSERT
+	expected := []byte(`a="https://docs.example.com";b="https://relay.example.com/ws";`)
+	if !bytes.Equal(result, expected) {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+// Verify an invalid regexp fails provisioning
+func TestProvisionRejectsInvalidRegexp(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		Rules: []RewriteRule{{From: "(unclosed", To: "x", Regexp: true}},
+	}
+
+	// ACT
+	ctx := createTestContext(t)
+	err := injector.Provision(ctx)
+
+	// ASSERT
+	if err == nil {
+		t.Error("Expected error for invalid regexp, got nil")
+	}
+}
+
+// Verify placeholders in replacements are expanded per request
+func TestRulePlaceholdersExpandPerRequest(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		Rules: []RewriteRule{
+			{From: "https://relay.vibekanban.com", To: "https://{http.request.host}/relay"},
+			{From: `"port":(\d+)`, To: `"host":"{http.request.host}","port":${1}`, Regexp: true},
+		},
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	js := []byte(`r="https://relay.vibekanban.com";c={"port":3001};`)
+
+	for _, host := range []string{"localhost", "vk.tailnet.ts.net"} {
+		t.Run(host, func(t *testing.T) {
+			req := withReplacer(httptest.NewRequest("GET", "http://"+host+"/assets/index.js", nil))
+
+			// ACT
+			result, _ := injector.rewriteBody(req, js)
+
+			// ASSERT
+			expected := []byte(`r="https://` + host + `/relay";c={"host":"` + host + `","port":3001};`)
+			if !bytes.Equal(result, expected) {
+				t.Errorf("Expected %q, got %q", expected, result)
+			}
+		})
+	}
+}
+
+// Verify Caddyfile parsing of the cloud URL argument and rule subdirectives
+func TestUnmarshalCaddyfileRules(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite https://vk.example.com {
+		rule https://docs.vibekanban.com https://docs.example.com
+		rule wss://relay.vibekanban.com wss://relay.example.com
+		rule_regexp "https://([a-z]+)\\.vibekanban\\.com" "https://$1.{http.request.host}"
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if p.CloudURL != "https://vk.example.com" {
+		t.Errorf("Expected cloud URL 'https://vk.example.com', got '%s'", p.CloudURL)
+	}
+	if len(p.Rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(p.Rules))
+	}
+	if p.Rules[1].From != "wss://relay.vibekanban.com" || p.Rules[1].To != "wss://relay.example.com" {
+		t.Errorf("Unexpected second rule: %+v", p.Rules[1])
+	}
+	if !p.Rules[2].Regexp || p.Rules[2].To != "https://$1.{http.request.host}" {
+		t.Errorf("Unexpected regexp rule: %+v", p.Rules[2])
+	}
+}
+
+// Verify malformed rule subdirectives are rejected
+func TestUnmarshalCaddyfileRuleErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"missing to", `vk_rewrite {
+			rule https://docs.vibekanban.com
+		}`},
+		{"too many args", `vk_rewrite {
+			rule a b c
+		}`},
+		{"regexp missing replacement", `vk_rewrite {
+			rule_regexp "^a$"
+		}`},
+		{"unknown subdirective", `vk_rewrite {
+			bogus value
+		}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var p PluginInjector
+			if err := p.UnmarshalCaddyfile(caddyfile.NewTestDispenser(tc.input)); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
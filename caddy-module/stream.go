@@ -0,0 +1,222 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultStreamWindow is how many trailing bytes a regexp stage holds back
+// between writes when no window is configured.
+const defaultStreamWindow = 4096
+
+// streamStage applies a single rule to a stream of writes. It keeps a
+// carry-over window of unprocessed bytes so matches spanning Write
+// boundaries are still found.
+type streamStage struct {
+	*activeRule
+	window  int
+	pending []byte
+}
+
+// push appends data to the stage and returns the bytes that are safe to pass
+// on. When final is set, everything pending is processed and returned.
+func (s *streamStage) push(data []byte, final bool) []byte {
+	s.pending = append(s.pending, data...)
+
+	if final {
+		out, n := s.apply(s.pending, s.to)
+		s.count += n
+		s.pending = nil
+		return out
+	}
+
+	// Bytes before safe can never be the start of a match that isn't
+	// entirely contained in pending
+	safe := len(s.pending) - s.window
+	if safe <= 0 {
+		return nil
+	}
+
+	var out []byte
+	var cut int
+	if s.re != nil {
+		out, cut = s.pushRegexp(safe)
+	} else {
+		out, cut = s.pushLiteral(safe)
+	}
+
+	// Shift the carry-over window to the front of the buffer
+	s.pending = append(s.pending[:0], s.pending[cut:]...)
+	return out
+}
+
+// pushLiteral replaces literal matches starting before safe.
+func (s *streamStage) pushLiteral(safe int) ([]byte, int) {
+	from := []byte(s.From)
+	out := make([]byte, 0, safe)
+
+	i := 0
+	for {
+		j := bytes.Index(s.pending[i:], from)
+		if j < 0 || i+j >= safe {
+			break
+		}
+		out = append(out, s.pending[i:i+j]...)
+		out = append(out, s.to...)
+		i += j + len(from)
+		s.count++
+	}
+	if i < safe {
+		out = append(out, s.pending[i:safe]...)
+		i = safe
+	}
+
+	return out, i
+}
+
+// pushRegexp replaces regexp matches that end before safe. A match that
+// straddles safe is held back (along with everything after it) so it can be
+// re-evaluated once more data arrives.
+func (s *streamStage) pushRegexp(safe int) ([]byte, int) {
+	out := make([]byte, 0, safe)
+
+	cut := safe
+	last := 0
+	for _, m := range s.re.FindAllSubmatchIndex(s.pending, -1) {
+		if m[0] >= safe {
+			break
+		}
+		if m[1] > safe {
+			cut = m[0]
+			break
+		}
+		out = append(out, s.pending[last:m[0]]...)
+		out = s.re.Expand(out, s.to, s.pending, m)
+		last = m[1]
+		s.count++
+	}
+	if last < cut {
+		out = append(out, s.pending[last:cut]...)
+	}
+
+	return out, cut
+}
+
+// streamRewriter applies the rule set to a response body as it is written,
+// with memory bounded by the carry-over windows of its stages.
+type streamRewriter struct {
+	dst     io.Writer
+	stages  []*streamStage
+	rules   []*activeRule
+	handler *PluginInjector
+
+	// req and headers identify the response for the expect_rewrites canary;
+	// both are nil when rewriting outside a response
+	req     *http.Request
+	headers http.Header
+
+	// elapsed is the time spent rewriting, excluding writes to dst
+	elapsed time.Duration
+}
+
+// newStreamRewriter creates a streaming rewriter writing to dst, with
+// placeholders in each rule's replacement expanded for the request.
+func (p *PluginInjector) newStreamRewriter(r *http.Request, dst io.Writer) *streamRewriter {
+	window := p.StreamWindow
+	if window <= 0 {
+		window = defaultStreamWindow
+	}
+
+	sw := &streamRewriter{dst: dst, rules: p.activeRules(r), handler: p}
+	for _, rule := range sw.rules {
+		stage := &streamStage{activeRule: rule}
+		if rule.re != nil {
+			stage.window = window
+		} else {
+			// A literal match can start at most len(From)-1 bytes from the end
+			stage.window = len(rule.From) - 1
+		}
+		sw.stages = append(sw.stages, stage)
+	}
+
+	return sw
+}
+
+// Write implements io.Writer.
+func (sw *streamRewriter) Write(b []byte) (int, error) {
+	start := time.Now()
+	out := b
+	for _, stage := range sw.stages {
+		out = stage.push(out, false)
+	}
+	sw.elapsed += time.Since(start)
+	if len(out) > 0 {
+		if _, err := sw.dst.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// newResponseStream creates a streaming rewriter for a response, checked
+// against the expect_rewrites canary once it is complete.
+func (p *PluginInjector) newResponseStream(r *http.Request, headers http.Header, dst io.Writer) *streamRewriter {
+	sw := p.newStreamRewriter(r, dst)
+	sw.req, sw.headers = r, headers
+	return sw
+}
+
+// Flush passes a flush on to dst. The carry-over windows are held back so
+// matches spanning the flush are still found.
+func (sw *streamRewriter) Flush() error {
+	return flushWriter(sw.dst)
+}
+
+// flushWriter flushes w if it buffers output, such as an encoder.
+func flushWriter(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close flushes the carry-over windows of all stages.
+func (sw *streamRewriter) Close() error {
+	start := time.Now()
+	var out []byte
+	for _, stage := range sw.stages {
+		out = stage.push(out, true)
+	}
+	sw.elapsed += time.Since(start)
+	sw.handler.metrics.observeRewrite(modeStreamLabel, sw.elapsed)
+	if len(out) > 0 {
+		if _, err := sw.dst.Write(out); err != nil {
+			return err
+		}
+	}
+
+	if sw.req == nil {
+		sw.handler.logRewrites(sw.rules)
+		return nil
+	}
+	sw.handler.reportRewrites(sw.req, modeStreamLabel, sw.rules, false)
+	count := 0
+	for _, rule := range sw.rules {
+		count += rule.count
+	}
+	if !sw.handler.checkExpectation(sw.req, count) {
+		banner, snippet := sw.handler.bannerFor(sw.headers)
+		if snippet != nil {
+			banner = snippet.html
+		}
+		if banner != "" {
+			if _, err := io.WriteString(sw.dst, banner); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
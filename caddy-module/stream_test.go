@@ -0,0 +1,228 @@
+package vibekanbanplugins
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// Verify streamed output matches buffered output regardless of write boundaries
+func TestStreamRewriterMatchesBuffered(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{
+		CloudURL: "https://vk.example.com",
+		Rules: []RewriteRule{
+			{From: "https://docs.vibekanban.com", To: "https://docs.example.com"},
+			{From: `wss://([a-z]+)\.vibekanban\.com`, To: "wss://$1.example.com", Regexp: true},
+		},
+		StreamWindow: 64,
+	}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	js := []byte(strings.Repeat(`fetch("https://api.vibekanban.com/v1");`+
+		`open("https://docs.vibekanban.com");connect("wss://relay.vibekanban.com");`, 50))
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+	expected, _ := injector.rewriteBody(req, js)
+
+	for _, chunkSize := range []int{1, 2, 7, 26, 100, 4096} {
+		t.Run(fmt.Sprintf("chunk %d", chunkSize), func(t *testing.T) {
+			var out bytes.Buffer
+			sw := injector.newStreamRewriter(req, &out)
+
+			// ACT
+			for i := 0; i < len(js); i += chunkSize {
+				end := min(i+chunkSize, len(js))
+				if _, err := sw.Write(js[i:end]); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			if err := sw.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			// ASSERT
+			if !bytes.Equal(out.Bytes(), expected) {
+				t.Errorf("Streamed output differs from buffered output for chunk size %d", chunkSize)
+			}
+		})
+	}
+}
+
+// Verify only the carry-over window is held back between writes
+func TestStreamRewriterBoundedCarryOver(t *testing.T) {
+	// ARRANGE
+	injector := &PluginInjector{CloudURL: "https://vk.example.com"}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	sw := injector.newStreamRewriter(httptest.NewRequest("GET", "/", nil), &out)
+	chunk := bytes.Repeat([]byte("a"), 10000)
+
+	// ACT
+	if _, err := sw.Write(chunk); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// ASSERT
+	held := len(chunk) - out.Len()
+	if held != len(officialCloudURL)-1 {
+		t.Errorf("Expected %d bytes held back, got %d", len(officialCloudURL)-1, held)
+	}
+}
+
+// Verify streamed JavaScript reaches the client before the upstream finishes
+func TestServeHTTPStreamsJavaScript(t *testing.T) {
+	// ARRANGE
+	first := []byte(strings.Repeat(" ", 1000) + `a="https://api.vibe`)
+	second := []byte(`kanban.com";`)
+	var seenBeforeEnd int
+
+	rec := httptest.NewRecorder()
+	upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Header().Set("Content-Length", strconv.Itoa(len(first)+len(second)))
+		w.WriteHeader(200)
+		w.Write(first)
+		seenBeforeEnd = rec.Body.Len()
+		w.Write(second)
+		return nil
+	})
+
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Stream: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Failed to provision injector: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/assets/index.js", nil)
+
+	// ACT
+	err := injector.ServeHTTP(rec, req, upstream)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+	if seenBeforeEnd == 0 {
+		t.Error("Expected part of the body to be written before upstream finished")
+	}
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Expected Content-Length to be removed, got %s", got)
+	}
+	expected := `a="https://vk.example.com";`
+	if got := strings.ReplaceAll(rec.Body.String(), " ", ""); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// Verify streaming is only used for uncompressed matched responses
+func TestShouldStream(t *testing.T) {
+	injector := &PluginInjector{CloudURL: "https://vk.example.com", Stream: true}
+	ctx := createTestContext(t)
+	if err := injector.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		method   string
+		status   int
+		headers  http.Header
+		expected bool
+	}{
+		{"javascript", "GET", 200, http.Header{"Content-Type": {"application/javascript"}}, true},
+		{"image", "GET", 200, http.Header{"Content-Type": {"image/png"}}, false},
+		{"html", "GET", 200, http.Header{"Content-Type": {"text/html; charset=utf-8"}}, false},
+		{"gzip", "GET", 200, http.Header{"Content-Type": {"application/javascript"}, "Content-Encoding": {"gzip"}}, false},
+		{"head", "HEAD", 200, http.Header{"Content-Type": {"application/javascript"}}, false},
+		{"not modified", "GET", 304, http.Header{"Content-Type": {"application/javascript"}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/assets/index.js", nil)
+			if got := injector.shouldStream(req, tc.status, tc.headers); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// Verify HTML rewrites the same whether or not stream is enabled
+func TestStreamHTMLMatchesBuffered(t *testing.T) {
+	// ARRANGE
+	page := []byte(`<html><head></head><body><!-- https://api.vibekanban.com -->` +
+		`<template><a href="https://api.vibekanban.com"></a></template>` +
+		`<script>fetch("https://api.vibekanban.com")</script></body></html>`)
+	serve := func(stream bool) string {
+		injector := &PluginInjector{
+			CloudURL:         "https://vk.example.com",
+			Stream:           stream,
+			DisableInjection: true,
+			Expect:           &RewriteExpectation{Paths: []string{"/"}, Min: 5, Banner: true},
+		}
+		ctx := createTestContext(t)
+		if err := injector.Provision(ctx); err != nil {
+			t.Fatalf("Failed to provision injector: %v", err)
+		}
+		upstream := mockNextHandler(page, 200, http.Header{"Content-Type": []string{"text/html"}})
+		rec := httptest.NewRecorder()
+		if err := injector.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil), upstream); err != nil {
+			t.Fatalf("Handler returned error: %v", err)
+		}
+		return rec.Body.String()
+	}
+
+	// ACT
+	buffered := serve(false)
+	streamed := serve(true)
+
+	// ASSERT
+	if streamed != buffered {
+		t.Errorf("Expected streamed HTML to match buffered\nbuffered: %s\nstreamed: %s", buffered, streamed)
+	}
+	if !strings.Contains(buffered, `<!-- https://api.vibekanban.com -->`) {
+		t.Errorf("Expected comment left alone, got %s", buffered)
+	}
+	body := strings.TrimSuffix(buffered, "</body></html>")
+	if body == buffered || !strings.HasPrefix(body, `<html><head></head><body><!-- https://api.vibekanban.com -->`) ||
+		!strings.Contains(body, `fetch("https://vk.example.com")</script><`) {
+		t.Errorf("Expected banner before </body>, got %s", buffered)
+	}
+}
+
+// Verify Caddyfile parsing of the stream subdirective
+func TestUnmarshalCaddyfileStream(t *testing.T) {
+	// ARRANGE
+	d := caddyfile.NewTestDispenser(`vk_rewrite {
+		stream 16KiB
+	}`)
+
+	// ACT
+	var p PluginInjector
+	err := p.UnmarshalCaddyfile(d)
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if !p.Stream {
+		t.Error("Expected streaming to be enabled")
+	}
+	if p.StreamWindow != 16384 {
+		t.Errorf("Expected stream window 16384, got %d", p.StreamWindow)
+	}
+}
@@ -0,0 +1,10 @@
+/**
+ * Phase 1 Test Injection Script
+ *
+ * Minimal script used by the handler tests to verify that the
+ * Caddy Plugin Injector inserts content before the closing body tag.
+ */
+(function () {
+  console.log('[Caddy Plugin Injector] Phase 1 test script loaded');
+  document.documentElement.setAttribute('data-vk-injected', 'true');
+})();
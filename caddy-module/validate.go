@@ -0,0 +1,102 @@
+package vibekanbanplugins
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// placeholderPattern matches Caddy placeholders in a cloud URL.
+var placeholderPattern = regexp.MustCompile(`\{[^{}]+\}`)
+
+// normalizeCloudURL trims whitespace and trailing slashes, which would
+// otherwise double up with the API paths the bundle appends.
+func normalizeCloudURL(raw string) string {
+	return strings.TrimRight(strings.TrimSpace(raw), "/")
+}
+
+// checkCloudURL rejects values that can't be a cloud base URL: the bundle
+// appends API paths to it, so it must be a bare http or https origin.
+// Placeholders are checked as if they expanded to a host name, and values
+// starting with a placeholder are only known per request.
+func checkCloudURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("empty cloud URL")
+	}
+	if strings.HasPrefix(raw, "{") {
+		return nil
+	}
+	u, err := url.Parse(placeholderPattern.ReplaceAllString(raw, "placeholder"))
+	if err != nil {
+		return fmt.Errorf("parsing cloud URL %q: %v", raw, err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("cloud URL %q must start with http:// or https://", raw)
+	case u.Host == "":
+		return fmt.Errorf("cloud URL %q has no host", raw)
+	case u.User != nil:
+		return fmt.Errorf("cloud URL %q must not contain credentials", raw)
+	case u.Path != "" && u.Path != "/":
+		return fmt.Errorf("cloud URL %q must not have a path; API paths are appended to it", raw)
+	case u.RawQuery != "" || u.ForceQuery || u.Fragment != "":
+		return fmt.Errorf("cloud URL %q must not have a query or fragment", raw)
+	}
+	return nil
+}
+
+// Validate implements caddy.Validator.
+func (p *PluginInjector) Validate() error {
+	cloudURLs := p.standbyURLs
+	if p.resolvedCloudURL != "" {
+		cloudURLs = append([]string{p.resolvedCloudURL}, cloudURLs...)
+	}
+	for _, cloudURL := range cloudURLs {
+		if err := checkCloudURL(cloudURL); err != nil {
+			return fmt.Errorf("%s: %v", p.cloudURLSource, err)
+		}
+	}
+	if len(p.standbyURLs) > 0 && p.HealthCheck == nil {
+		return fmt.Errorf("cloud_urls: standby clouds need a health_check to fail over to them")
+	}
+	if p.HealthCheck != nil {
+		for _, cloudURL := range cloudURLs {
+			if _, err := p.probeTarget(cloudURL); err != nil {
+				return fmt.Errorf("health_check: %v", err)
+			}
+		}
+	}
+	if p.StreamWindow < 0 {
+		return fmt.Errorf("stream_window must not be negative")
+	}
+	if p.CacheSize < 0 {
+		return fmt.Errorf("cache_size must not be negative")
+	}
+	if p.CloudURLFileInterval < 0 {
+		return fmt.Errorf("cloud_url_file_interval must not be negative")
+	}
+	return nil
+}
+
+// warnMixedContent logs, once per rule set, when an https site rewrites
+// the bundle to an http cloud URL, whose API calls browsers block as
+// mixed content.
+func (p *PluginInjector) warnMixedContent(r *http.Request) {
+	set := p.servingRules(r)
+	if r.TLS == nil || set.cloudURL == "" || set.mixedContentWarned.Load() {
+		return
+	}
+	cloudURL := requestReplacer(r).ReplaceKnown(set.cloudURL, "")
+	if !strings.HasPrefix(strings.ToLower(cloudURL), "http://") {
+		return
+	}
+	if set.mixedContentWarned.CompareAndSwap(false, true) {
+		p.logger.Warn("https site is rewritten to an http cloud URL; browsers will block its API calls as mixed content",
+			zap.String("host", r.Host),
+			zap.String("cloud_url", cloudURL))
+	}
+}